@@ -0,0 +1,116 @@
+package fsplit
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ImportAudit describes the imports of a generated file compared to its original files
+type ImportAudit struct {
+	// File is the name of the generated file
+	File string `json:"file"`
+	// Imports are the import paths of the generated file in sorted order
+	Imports []string `json:"imports"`
+	// Unexpected are the imports of the generated file that none of its original files has
+	// They indicate that goimports resolved an identifier to a different package.
+	Unexpected []string `json:"unexpected"`
+}
+
+// auditImports compares the imports of the generated files with those of their original files
+// The audits are in the order the files first appear in funcFiles.
+func auditImports(fsys FileSystem, funcFiles []SingleFunctionFile) ([]ImportAudit, error) {
+	var audits []ImportAudit
+	originalImports := make(map[string]string)
+	for _, funcFile := range funcFiles {
+		if _, ok := originalImports[funcFile.FileName]; !ok {
+			audits = append(audits, ImportAudit{File: funcFile.FileName})
+		}
+		originalImports[funcFile.FileName] += funcFile.Imports
+	}
+
+	for i, audit := range audits {
+		src, err := fsys.ReadFile(audit.File)
+		if err != nil {
+			return nil, err
+		}
+		if audits[i].Imports, err = importPaths(string(src)); err != nil {
+			return nil, fmt.Errorf("Error reading imports of %s: %v", audit.File, err)
+		}
+		added, err := addedImports(originalImports[audit.File], src)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading imports of %s: %v", audit.File, err)
+		}
+		audits[i].Unexpected = append([]string{}, added...)
+	}
+	return audits, nil
+}
+
+// addedImports returns the imports of the generated source that are missing from the original import declarations
+func addedImports(originalImports string, generated []byte) ([]string, error) {
+	original, err := importPaths("package p\n" + originalImports)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := importPaths(string(generated))
+	if err != nil {
+		return nil, err
+	}
+	var added []string
+	for _, path := range paths {
+		if !slices.Contains(original, path) {
+			added = append(added, path)
+		}
+	}
+	return added, nil
+}
+
+// importPaths returns the sorted import paths of the Go source
+func importPaths(src string) ([]string, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), "", src, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	for _, spec := range file.Imports {
+		if path, err := strconv.Unquote(spec.Path.Value); err == nil && !slices.Contains(paths, path) {
+			paths = append(paths, path)
+		}
+	}
+	slices.Sort(paths)
+	return paths, nil
+}
+
+// ImportsReport renders the import audit of the result as text, one line per generated file
+// Files with unexpected imports are flagged, and the last line counts the distinct imports of all files.
+func (r *Result) ImportsReport() string {
+	var sb strings.Builder
+	var all []string
+	for _, audit := range r.ImportAudit {
+		fmt.Fprintf(&sb, "%s: %d imports", audit.File, len(audit.Imports))
+		if len(audit.Imports) > 0 {
+			fmt.Fprintf(&sb, " (%s)", strings.Join(audit.Imports, ", "))
+		}
+		if len(audit.Unexpected) > 0 {
+			fmt.Fprintf(&sb, ", UNEXPECTED: %s", strings.Join(audit.Unexpected, ", "))
+		}
+		sb.WriteString("\n")
+		for _, path := range audit.Imports {
+			if !slices.Contains(all, path) {
+				all = append(all, path)
+			}
+		}
+	}
+	fmt.Fprintf(&sb, "%d distinct imports in %d generated files\n", len(all), len(r.ImportAudit))
+	return sb.String()
+}
+
+// HasUnexpectedImports checks if any generated file imports a package none of its original files imports
+func (r *Result) HasUnexpectedImports() bool {
+	return slices.ContainsFunc(r.ImportAudit, func(audit ImportAudit) bool {
+		return len(audit.Unexpected) > 0
+	})
+}
@@ -0,0 +1,50 @@
+package fsplit
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// unresolvedFiles is a package where A refers to rand without importing it, which goimports resolves to a package of its choice
+var unresolvedFiles = map[string]string{
+	"a.go": "package p\n\nimport \"fmt\"\n\nfunc A() int { return rand.Int() }\n\nfunc B() { fmt.Println() }\n",
+}
+
+func TestNoNewImports(t *testing.T) {
+	dir := writePackage(t, unresolvedFiles)
+	_, err := RunFsplitWithOptions(dir, Options{NoNewImports: true, NoConfigFile: true})
+	// Which rand package goimports picks does not matter, only that it is refused
+	if err == nil || !strings.Contains(err.Error(), "goimports added imports its original files do not have: ") || !strings.HasSuffix(err.Error(), "/rand") {
+		t.Fatalf("err = %v, want a rand package reported as added", err)
+	}
+	if got := readPackage(t, dir); !maps.Equal(got, unresolvedFiles) {
+		t.Errorf("files after the refused split = %v, want %v", got, unresolvedFiles)
+	}
+}
+
+func TestAuditImports(t *testing.T) {
+	dir := writePackage(t, unresolvedFiles)
+	result, files := runFsplit(t, dir, Options{AuditImports: true})
+	if len(result.ImportAudit) != 2 {
+		t.Fatalf("audited %d files, want 2", len(result.ImportAudit))
+	}
+	a, b := result.ImportAudit[0], result.ImportAudit[1]
+	if !strings.HasSuffix(a.File, "a._.A.fsplit.go") || len(a.Unexpected) != 1 || !slices.Equal(a.Imports, a.Unexpected) {
+		t.Fatalf("audit of A = %+v, want the guessed rand import flagged", a)
+	}
+	if !strings.HasSuffix(b.File, "a._.B.fsplit.go") || !slices.Equal(b.Imports, []string{"fmt"}) || len(b.Unexpected) != 0 {
+		t.Errorf("audit of B = %+v, want fmt and nothing flagged", b)
+	}
+	if !result.HasUnexpectedImports() {
+		t.Error("HasUnexpectedImports() = false, want true")
+	}
+	if !strings.Contains(result.ImportsReport(), "a._.A.fsplit.go: 1 imports ("+a.Imports[0]+"), UNEXPECTED: "+a.Imports[0]+"\n") {
+		t.Errorf("ImportsReport() does not flag A:\n%s", result.ImportsReport())
+	}
+	// Auditing does not refuse the split
+	if _, ok := files["a._.A.fsplit.go"]; !ok {
+		t.Errorf("files = %v, want A split", fileNames(files))
+	}
+}
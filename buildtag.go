@@ -0,0 +1,72 @@
+package fsplit
+
+import (
+	"fmt"
+	"go/build/constraint"
+	"path/filepath"
+	"strings"
+)
+
+// parseBuildTag checks that the tag of Options.BuildTag is a single build tag
+func parseBuildTag(tag string) (*constraint.TagExpr, error) {
+	expr, err := constraint.Parse("//go:build " + tag)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid build tag %q: %v", tag, err)
+	}
+	tagExpr, ok := expr.(*constraint.TagExpr)
+	if !ok {
+		return nil, fmt.Errorf("Invalid build tag %q: it must be a single tag", tag)
+	}
+	return tagExpr, nil
+}
+
+// withBuildTag adds the tag to the build constraint of the package declaration, negated if not is set
+// An existing //go:build line is combined with the tag, and otherwise a new one is added in front.
+func withBuildTag(packageDecl string, tag *constraint.TagExpr, not bool) string {
+	var tagExpr constraint.Expr = tag
+	if not {
+		tagExpr = &constraint.NotExpr{X: tag}
+	}
+	lines := strings.SplitAfter(packageDecl, "\n")
+	for i, line := range lines {
+		text := strings.TrimSpace(line)
+		if !constraint.IsGoBuild(text) {
+			continue
+		}
+		if expr, err := constraint.Parse(text); err == nil {
+			lines[i] = "//go:build " + (&constraint.AndExpr{X: expr, Y: tagExpr}).String() + "\n"
+			return strings.Join(lines, "")
+		}
+	}
+	return "//go:build " + tagExpr.String() + "\n\n" + packageDecl
+}
+
+// unsplitFileName returns the name of the file keeping the functions split from the original file behind the negated build tag
+func unsplitFileName(source string, splitSuffix string) string {
+	dir, base := filepath.Split(source)
+	stem := strings.TrimSuffix(strings.TrimSuffix(base, ".go"), "_test") + ".unsplit"
+	if isTestFile(base) {
+		return filepath.Join(dir, stem+"."+splitSuffix+"_test.go")
+	}
+	return filepath.Join(dir, stem+"."+splitSuffix+".go")
+}
+
+// isUnsplitFileName checks if the file name is one returned by unsplitFileName
+func isUnsplitFileName(fileName string, splitSuffix string) bool {
+	return strings.HasSuffix(fileName, ".unsplit."+splitSuffix+".go") || strings.HasSuffix(fileName, ".unsplit."+splitSuffix+"_test.go")
+}
+
+// buildTagVariants puts the generated files behind Options.BuildTag and adds the unsplit files behind its negation
+// Every original file gets one unsplit file with all functions split from it, so that building without the tag
+// compiles the same functions as before the split, and building with it compiles the split files.
+// It returns the unsplit files, which are merged per original file when they are written.
+func buildTagVariants(funcFiles []SingleFunctionFile, opts Options) []SingleFunctionFile {
+	var unsplit []SingleFunctionFile
+	for i, funcFile := range funcFiles {
+		funcFiles[i].Package = withBuildTag(funcFile.Package, opts.buildTag, false)
+		funcFile.FileName = unsplitFileName(funcFile.Source, opts.splitSuffix())
+		funcFile.Package = withBuildTag(funcFile.Package, opts.buildTag, true)
+		unsplit = append(unsplit, funcFile)
+	}
+	return unsplit
+}
@@ -0,0 +1,53 @@
+package fsplit
+
+import (
+	"go/build/constraint"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestBuildTagVariants(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"a.go": "package p\n\nfunc A() {}\n\nfunc B() {}\n",
+	})
+	_, files := runFsplit(t, dir, Options{BuildTag: "split"})
+	want := []string{"a._.A.fsplit.go", "a._.B.fsplit.go", "a.go", "a.unsplit.fsplit.go"}
+	if !slices.Equal(fileNames(files), want) {
+		t.Fatalf("files = %v, want %v", fileNames(files), want)
+	}
+	if !strings.Contains(files["a.unsplit.fsplit.go"], "func A() {}") || !strings.Contains(files["a.unsplit.fsplit.go"], "func B() {}") {
+		t.Errorf("a.unsplit.fsplit.go does not keep both functions:\n%s", files["a.unsplit.fsplit.go"])
+	}
+
+	// Every function is built exactly once, whether the tag is set or not
+	for _, tagged := range []bool{false, true} {
+		for _, name := range []string{"A", "B"} {
+			var built []string
+			for file, content := range files {
+				if strings.Contains(content, "func "+name+"()") && buildsWith(t, content, tagged) {
+					built = append(built, file)
+				}
+			}
+			if len(built) != 1 {
+				t.Errorf("with split=%v, %s is built from %v, want exactly one file", tagged, name, built)
+			}
+		}
+	}
+}
+
+// buildsWith reports whether the file is built with the split tag set or not, by its //go:build line
+func buildsWith(t *testing.T, content string, tagged bool) bool {
+	t.Helper()
+	for _, line := range strings.Split(content, "\n") {
+		if !constraint.IsGoBuild(line) {
+			continue
+		}
+		expr, err := constraint.Parse(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return expr.Eval(func(tag string) bool { return tag == "split" && tagged })
+	}
+	return true
+}
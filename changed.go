@@ -0,0 +1,103 @@
+package fsplit
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// lineRange is an inclusive range of line numbers
+type lineRange struct {
+	start, end int
+}
+
+// gitDiff returns the diff of the working tree in dir against ref with no context lines
+// Paths in the diff are relative to dir and prefixed with a/ and b/ regardless of diff.noprefix or diff.mnemonicPrefix.
+// It is a variable so that tests can stub git out.
+var gitDiff = func(dir string, ref string) ([]byte, error) {
+	cmd := exec.Command("git", "diff", "--no-color", "--no-ext-diff", "--src-prefix=a/", "--dst-prefix=b/", "--relative", "--unified=0", ref, "--", ".")
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git diff %s: %v: %s", ref, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// changedLines returns the lines changed in the package directory since the git ref, keyed by file name
+// Deleted lines mark the lines around them as changed, so that removing lines from a function counts as changing it.
+func changedLines(dir string, ref string) (map[string][]lineRange, error) {
+	diff, err := gitDiff(dir, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make(map[string][]lineRange)
+	fileName := ""
+	scanner := bufio.NewScanner(bytes.NewReader(diff))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "+++ "):
+			// Deleted files have no new name and no lines left to split
+			fileName = ""
+			if name, ok := strings.CutPrefix(line, "+++ b/"); ok {
+				fileName = filepath.Join(dir, filepath.FromSlash(name))
+			}
+		case strings.HasPrefix(line, "@@ ") && fileName != "":
+			r, err := parseHunkHeader(line)
+			if err != nil {
+				return nil, err
+			}
+			changed[fileName] = append(changed[fileName], r)
+		}
+	}
+	return changed, scanner.Err()
+}
+
+// parseHunkHeader returns the range of lines of the new file covered by a hunk header like "@@ -1,2 +3,4 @@"
+func parseHunkHeader(header string) (lineRange, error) {
+	fields := strings.Fields(header)
+	if len(fields) < 3 || !strings.HasPrefix(fields[2], "+") {
+		return lineRange{}, fmt.Errorf("Invalid hunk header: %q", header)
+	}
+	startStr, countStr, hasCount := strings.Cut(fields[2][1:], ",")
+	start, err := strconv.Atoi(startStr)
+	if err != nil {
+		return lineRange{}, fmt.Errorf("Invalid hunk header: %q", header)
+	}
+	count := 1
+	if hasCount {
+		if count, err = strconv.Atoi(countStr); err != nil {
+			return lineRange{}, fmt.Errorf("Invalid hunk header: %q", header)
+		}
+	}
+	if count == 0 {
+		// Lines were only deleted after the start line
+		return lineRange{start: start, end: start + 1}, nil
+	}
+	return lineRange{start: start, end: start + count - 1}, nil
+}
+
+// isChanged checks if any line of the function, including its doc comment, is in the changed ranges
+func isChanged(fset *token.FileSet, decl *ast.FuncDecl, ranges []lineRange) bool {
+	start := decl.Pos()
+	if decl.Doc != nil {
+		start = decl.Doc.Pos()
+	}
+	first, last := fset.Position(start).Line, fset.Position(decl.End()).Line
+	for _, r := range ranges {
+		if r.start <= last && first <= r.end {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package fsplit
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestChangedSince(t *testing.T) {
+	root := writePackage(t, map[string]string{
+		"a/a.go": `package a
+
+func A() int {
+	return 1
+}
+
+func B() int {
+	return 20
+}
+
+func C() int {
+	return 3
+}
+`,
+		"b/b.go": "package b\n\nfunc D() {}\n\nfunc E() {}\n",
+	})
+	// Only the body of B changed, and nothing in b
+	diffs := map[string]string{
+		filepath.Join(root, "a"): `diff --git a/a.go b/a.go
+index 1111111..2222222 100644
+--- a/a.go
++++ b/a.go
+@@ -8 +8 @@ func B() int {
+-	return 2
++	return 20
+`,
+	}
+	gitDiffOrig := gitDiff
+	t.Cleanup(func() { gitDiff = gitDiffOrig })
+	var refs []string
+	gitDiff = func(dir string, ref string) ([]byte, error) {
+		refs = append(refs, ref)
+		return []byte(diffs[dir]), nil
+	}
+
+	if _, err := RunFsplitRecursive(root, Options{ChangedSince: "HEAD", NoConfigFile: true}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"HEAD", "HEAD"}; !slices.Equal(refs, want) {
+		t.Errorf("diffed against %v, want %v", refs, want)
+	}
+	if want := []string{"a/a._.B.fsplit.go", "a/a.go", "b/b.go"}; !slices.Equal(fileNames(readPackage(t, root)), want) {
+		t.Errorf("files = %v, want %v", fileNames(readPackage(t, root)), want)
+	}
+}
@@ -0,0 +1,43 @@
+package fsplit
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Check returns the files of the package that still need splitting, in sorted order
+// A file needs splitting if a run with the options would extract a function from it, so every filter applies,
+// such as Options.ExportedOnly or Options.MinLines. The run is planned in memory and nothing is written.
+func Check(packagePath string, opts Options) ([]string, error) {
+	plan, err := PlanFsplit(packagePath, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range plan.Manifest.Created {
+		if !slices.Contains(files, entry.Source) {
+			files = append(files, entry.Source)
+		}
+	}
+	slices.Sort(files)
+	return files, nil
+}
+
+// CheckRecursive returns the files of every package under the root directory that still need splitting
+// Directories are walked as by RunFsplitRecursive.
+func CheckRecursive(root string, opts Options) ([]string, error) {
+	dirs, err := packageDirs(opts.fileSystem(), root, opts)
+	if err != nil {
+		return nil, fmt.Errorf("Error walking %s: %v", root, err)
+	}
+	var files []string
+	for _, dir := range dirs {
+		f, err := Check(dir, opts)
+		if err != nil {
+			return nil, fmt.Errorf("Error checking %s: %w", dir, err)
+		}
+		files = append(files, f...)
+	}
+	return files, nil
+}
@@ -0,0 +1,58 @@
+package fsplit
+
+import (
+	"path/filepath"
+	"regexp"
+	"slices"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	src := `package a
+
+func Exported() {
+	println()
+}
+
+func unexported() {}
+
+func Long() {
+	println()
+	println()
+}
+
+func Short() {}
+`
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"default", Options{}},
+		{"exported only", Options{ExportedOnly: true}},
+		{"min lines", Options{MinLines: 3}},
+		{"include", Options{Include: regexp.MustCompile("^L")}},
+		{"exclude", Options{Exclude: regexp.MustCompile("^[LS]")}},
+		{"catch-all", Options{MinLines: 3, CatchAll: "small"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writePackage(t, map[string]string{"a.go": src, "b.go": "package a\n\nfunc B() {}\n"})
+			tt.opts.NoConfigFile = true
+			files, err := Check(dir, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []string{filepath.Join(dir, "a.go")}; !slices.Equal(files, want) {
+				t.Errorf("Check() before splitting = %v, want %v", files, want)
+			}
+
+			runFsplit(t, dir, tt.opts)
+			if files, err = Check(dir, tt.opts); err != nil {
+				t.Fatal(err)
+			}
+			if len(files) > 0 {
+				t.Errorf("Check() after splitting = %v, want none", files)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/nakario/fsplit"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <package-path>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	typeName := flag.String("type", "", "merge only the files of the methods whose receiver type is `name`")
+	suffix := flag.String("suffix", "fsplit", "merge generated files named foo._.Bar.`suffix`.go")
+	format := flag.String("format", string(fsplit.FormatGoimports), "formatter of merged files: goimports or gofmt")
+	verbose := flag.Bool("v", false, "log every action")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		log.Fatalln("Error: package path is required")
+	}
+	packagePath := flag.Arg(0)
+
+	opts := fsplit.Options{
+		Verbose: *verbose,
+		Suffix:  *suffix,
+		Format:  fsplit.Format(*format),
+	}
+	result, err := fsplit.RunFmerge(packagePath, *typeName, opts)
+	if err != nil {
+		log.Fatalf("Error running fmerge: %v\n", err)
+	}
+	if len(result.Merged) == 0 {
+		log.Printf("%s: no generated files to merge\n", packagePath)
+	}
+}
@@ -1,30 +1,521 @@
 package main
 
 import (
+	"cmp"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"regexp"
+	"slices"
+	"strings"
 
 	"github.com/nakario/fsplit"
 )
 
+// mappingFlag is a repeatable flag of the form Name=file.go
+type mappingFlag map[string]string
+
+func (m mappingFlag) String() string {
+	return fmt.Sprint(map[string]string(m))
+}
+
+func (m mappingFlag) Set(value string) error {
+	name, file, ok := strings.Cut(value, "=")
+	if !ok || name == "" || file == "" {
+		return fmt.Errorf("expected Name=file.go, got %q", value)
+	}
+	m[name] = file
+	return nil
+}
+
+// stringsFlag is a repeatable string flag
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
 func main() {
 	flag.Usage = func() {
-		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s <package-path>\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <package-path | file.go>\n", os.Args[0])
 		flag.PrintDefaults()
 	}
 
+	recursive := flag.Bool("recursive", false, "split every package under the directory (also enabled by a path ending in /...)")
+	var rewrite stringsFlag
+	flag.Var(&rewrite, "rewrite", "apply the gofmt -r `rule` to generated files (repeatable)")
+	noNewImports := flag.Bool("no-new-imports", false, "fail if goimports would give a generated file an import its original file does not have")
+	auditImports := flag.Bool("audit-imports", false, "report the imports of generated files and exit with status 1 if one imports a package its original file does not")
+	deadline := flag.Duration("deadline", 0, "with -recursive, stop starting new packages after `duration` and report the skipped ones")
+	noIgnore := flag.Bool("no-ignore", false, "with -recursive, also descend into vendor, testdata, dot and .gitignore-d directories")
+	verbose := flag.Bool("v", false, "log every action")
+	layout := flag.String("layout", string(fsplit.LayoutSingle), "layout of the split files: single or hybrid")
+	var skip stringsFlag
+	flag.Var(&skip, "skip", "do not split files whose base name matches the `glob` (repeatable)")
+	exportedOnly := flag.Bool("exported-only", false, "split only exported functions and methods")
+	minFuncs := flag.Int("min-funcs", 2, "split only files with at least `N` functions")
+	splitAbove := flag.Int("split-above", 0, "split only files with more than `N` functions (same as -min-funcs N+1)")
+	maxFuncs := flag.Int("max-funcs", 0, "split only files with at most `N` functions (0 means no limit)")
+	include := flag.String("include", "", "split only functions whose name matches the `regexp` (methods are named Type.Method)")
+	exclude := flag.String("exclude", "", "keep functions whose name matches the `regexp` in place")
+	funcsFrom := flag.String("funcs-from", "", "split only the functions listed in the `file`, one name per line (Type.Method for methods)")
+	sig := flag.String("sig", "", "split only functions with the `signature`, like 'func(context.Context) error'")
+	minLines := flag.Int("min-lines", 0, "split only functions spanning at least `N` lines")
+	keepOne := flag.String("keep-one", "", "keep the function `name` (Type.Method for methods), or the first function if there is none, in every split original file")
+	catchAll := flag.String("catch-all", "", "gather functions shorter than -min-lines into a single `name`.fsplit.go file")
+	packLines := flag.Int("pack-lines", 0, "pack consecutive functions into one file until their lines would exceed `N`")
+	maxFileLines := flag.Int("max-file-lines", 0, "fail if a generated file would have more than `N` lines (0 means no limit)")
+	changedSince := flag.String("changed-since", "", "split only functions changed since the git `ref`")
+	tests := flag.Bool("tests", false, "split test files too")
+	flag.BoolVar(tests, "include-tests", false, "same as -tests")
+	keepTestMain := flag.Bool("keep-testmain", false, "keep TestMain in its original file when splitting test files")
+	skipExamples := flag.Bool("skip-examples", false, "keep example functions in their original file when splitting test files")
+	mapping := make(mappingFlag)
+	flag.Var(mapping, "map", "extract the function into the file, as `Name=file.go` (repeatable; methods are named Type.Method)")
+	pathNames := flag.Bool("path-names", false, "prefix generated file names with the path from a //fsplit:path marker or the build constraint")
+	docNote := flag.Bool("doc-note", false, "append a line naming the original file to the doc comments of extracted functions")
+	stripSeeAlso := flag.Bool("strip-see-also", false, "remove stale '// See also foo.go' lines from the doc comments of extracted functions")
+	moveExclusiveVars := flag.Bool("move-exclusive-vars", false, "move unexported package-level vars only one extracted function uses into its generated file")
+	constructorWithType := flag.Bool("constructor-with-type", false, "keep New<T> constructors with the declaration of type T instead of splitting them")
+	comments := flag.String("comments", string(fsplit.CommentsAdjacent), "which comments move with a function: strict, adjacent or loose")
+	detachedDocLines := flag.Int("detached-doc-lines", 0, "move a comment separated from the following function by at most `N` blank lines with it")
+	groupInits := flag.Bool("group-inits", false, "collect the init functions of the package into a single init.fsplit.go file")
+	format := flag.String("format", string(fsplit.FormatGoimports), "formatter of created and rewritten files: goimports or gofmt (keeps imports as copied, minus unused ones)")
+	singleImportGroup := flag.Bool("single-import-group", false, "write the imports of generated files as a single group without blank lines")
+	sortByName := flag.Bool("sort-by-name", false, "order functions gathered into one file by name instead of source position")
+	emitDocHTML := flag.Bool("emit-doc-html", false, "write a godoc HTML snippet next to every generated file")
+	buildTag := flag.String("build-tag", "", "put generated files behind the build `tag` and keep the split functions behind !tag in <stem>.unsplit.fsplit.go files")
+	header := flag.String("header", "", "prepend the contents of the `file`, such as a license header, to every generated file")
+	index := flag.Bool("index", false, "write fsplit.index.go mapping the split functions to their files")
+	caseSafeNames := flag.Bool("case-safe-names", false, "append -2, -3, ... to generated file names that differ from another only by case")
+	qualifyNames := flag.Bool("qualify-names", false, "prefix generated file names with the package name")
+	order := flag.Bool("order", false, "prefix generated file names with the position of the function to keep declaration order")
+	suffix := flag.String("suffix", "fsplit", "name generated files foo._.Bar.`suffix`.go")
+	goGenerate := flag.Bool("go-generate", false, "add a '//go:generate fsplit .' directive to the package unless it has one")
+	goGenerateFile := flag.String("go-generate-file", "", "add the -go-generate directive to `file` instead of the package doc file")
+	subdirs := flag.Bool("subdirs", false, "experimental: write single function files into a subdirectory per receiver type, or _ for functions")
+	subPackage := flag.Bool("subpackage", false, "move exported self-contained functions into the sub-package <pkg>/fsplit and keep forwarders to them")
+	outDir := flag.String("out", "", "write generated files into the existing `dir` and leave the original files untouched")
+	moduleRelative := flag.Bool("module-relative", false, "with -out, write generated files at the package path relative to the module root")
+	flatNames := flag.String("flat-names", string(fsplit.FlatNamesReadable), "with -out, how to name generated files: readable or hash (of the import path and readable name, listed in fsplit.names.json)")
+	quiet := flag.Bool("quiet", false, "do not print the summary of the run to stderr")
+	dryRun := flag.Bool("dry-run", false, "log the files that would be written or removed without changing anything")
+	remainingSuffix := flag.String("remaining-suffix", "", "rename split original files to <stem>.`suffix`.go")
+	removeEmpty := flag.String("remove-empty", string(fsplit.RemoveEmptyNever), "what to do with original files that became empty: never (keep stubs) or only (delete them)")
+	removeOnly := flag.Bool("remove-only", false, "only remove the functions whose generated files already exist, matching them by file name")
+	noConfig := flag.Bool("no-config", false, "ignore .fsplit.toml files")
+	force := flag.Bool("force", false, "allow modifying packages under GOROOT and splitting cgo files")
+	verify := flag.Bool("verify", false, "re-parse every written file, check that no symbol was lost or duplicated, and roll back all changes on failure")
+	verifyReversible := flag.Bool("verify-reversible", false, "check that joining the split files back in memory reproduces every original file, and change nothing if not")
+	runTests := flag.Bool("run-tests", false, "run go test on the package after splitting and roll back if it fails")
+	normalizeImportsOnly := flag.Bool("normalize-imports-only", false, "only re-normalize the imports of the files generated by fsplit")
+	report := flag.String("report", "", "print a report of the split files: markdown")
+	manifest := flag.String("manifest", "", "write a JSON manifest of the created and modified files to the `file`")
+	jsonPlan := flag.String("json-plan", "", "write the planned changes as JSON to the `file` instead of applying them")
+	check := flag.Bool("check", false, "exit with status 1 and list the files that still need splitting, without writing anything")
+	list := flag.Bool("l", false, "list the files that would be split, without writing anything")
+	stdout := flag.Bool("stdout", false, "print the generated files to stdout, each after a '// === name ===' banner, instead of writing them (single file only)")
+	fromGoList := flag.Bool("from-go-list", false, "split the packages whose import paths are read from stdin, one per line, as printed by 'go list ./...'")
+	fromStdin := flag.Bool("stdin", false, "split the packages or files whose paths are read from stdin, one per line, and exit with status 1 if any failed")
+	applyPlan := flag.String("apply-plan", "", "apply the changes of a plan `file` written by -json-plan without analyzing the package again")
 	flag.Parse()
 
+	if *applyPlan != "" {
+		data, err := os.ReadFile(*applyPlan)
+		if err != nil {
+			log.Fatalf("Error reading plan: %v\n", err)
+		}
+		plan, err := fsplit.ReadPlan(data)
+		if err != nil {
+			log.Fatalf("Error parsing plan: %v\n", err)
+		}
+		if err := fsplit.ApplyPlan(plan, fsplit.Options{Verbose: *verbose}); err != nil {
+			log.Fatalf("Error applying plan: %v\n", err)
+		}
+		return
+	}
+
 	// Check if the package path is provided as a positional argument
-	if flag.NArg() < 1 {
+	if *fromGoList && *fromStdin {
+		log.Fatalln("Error: -from-go-list and -stdin cannot be combined")
+	}
+	if *fromStdin {
+		if flag.NArg() > 0 {
+			flag.Usage()
+			log.Fatalln("Error: -stdin reads the paths from stdin and takes no package path")
+		}
+		if *normalizeImportsOnly || *list || *stdout || *jsonPlan != "" || *check || *dryRun {
+			log.Fatalln("Error: -stdin only supports splitting")
+		}
+	} else if *fromGoList {
+		if flag.NArg() > 0 {
+			flag.Usage()
+			log.Fatalln("Error: -from-go-list reads the packages from stdin and takes no package path")
+		}
+		if *normalizeImportsOnly || *list || *stdout || *jsonPlan != "" || *check || *dryRun {
+			log.Fatalln("Error: -from-go-list only supports splitting")
+		}
+	} else if flag.NArg() < 1 {
 		flag.Usage()
 		log.Fatalln("Error: package path is required")
 	}
 
+	if *report != "" && *report != "markdown" {
+		flag.Usage()
+		log.Fatalf("Error: unknown report format: %s\n", *report)
+	}
+
 	packagePath := flag.Arg(0)
-	if err := fsplit.RunFsplit(packagePath); err != nil {
+	includeRegexp, err := compileRegexp(*include)
+	if err != nil {
+		log.Fatalf("Error: invalid -include: %v\n", err)
+	}
+	excludeRegexp, err := compileRegexp(*exclude)
+	if err != nil {
+		log.Fatalf("Error: invalid -exclude: %v\n", err)
+	}
+	var headerText string
+	if *header != "" {
+		data, err := os.ReadFile(*header)
+		if err != nil {
+			log.Fatalf("Error: invalid -header: %v\n", err)
+		}
+		headerText = string(data)
+	}
+	funcs, err := readFuncNames(*funcsFrom)
+	if err != nil {
+		log.Fatalf("Error: invalid -funcs-from: %v\n", err)
+	}
+	opts := fsplit.Options{
+		Verbose: *verbose,
+		Layout:  fsplit.Layout(*layout),
+
+		Skip:                skip,
+		ExportedOnly:        *exportedOnly,
+		MinFuncs:            max(*minFuncs, *splitAbove+1),
+		MaxFuncs:            *maxFuncs,
+		Include:             includeRegexp,
+		Exclude:             excludeRegexp,
+		Funcs:               funcs,
+		Signature:           *sig,
+		MinLines:            *minLines,
+		ChangedSince:        *changedSince,
+		IncludeTests:        *tests,
+		KeepTestMain:        *keepTestMain,
+		SkipExamples:        *skipExamples,
+		FileMapping:         mapping,
+		PathNames:           *pathNames,
+		KeepOne:             *keepOne,
+		CatchAll:            *catchAll,
+		GroupInits:          *groupInits,
+		CommentAssociation:  fsplit.CommentAssociation(*comments),
+		DetachedDocLines:    *detachedDocLines,
+		ConstructorWithType: *constructorWithType,
+		MoveExclusiveVars:   *moveExclusiveVars,
+		DocTransform:        docTransform(*stripSeeAlso, *docNote),
+		PackLines:           *packLines,
+		MaxFileLines:        *maxFileLines,
+		QualifyNames:        *qualifyNames,
+		DocHTML:             *emitDocHTML,
+		BuildTag:            *buildTag,
+		Header:              headerText,
+		Index:               *index,
+		CaseSafeNames:       *caseSafeNames,
+		SortByName:          *sortByName,
+		Order:               *order,
+		Suffix:              *suffix,
+		ModuleRelative:      *moduleRelative,
+		FlatNames:           fsplit.FlatNames(*flatNames),
+		OutDir:              *outDir,
+		Subdirs:             *subdirs,
+		SubPackage:          *subPackage,
+		GoGenerate:          *goGenerate,
+		GoGenerateFile:      *goGenerateFile,
+		RemainingSuffix:     *remainingSuffix,
+		RemoveEmpty:         fsplit.RemoveEmpty(*removeEmpty),
+		RemoveOnly:          *removeOnly,
+		Force:               *force,
+		Format:              fsplit.Format(*format),
+		SingleImportGroup:   *singleImportGroup,
+		Verify:              *verify,
+		VerifyReversible:    *verifyReversible,
+		RunTests:            *runTests,
+		NoIgnore:            *noIgnore,
+		Deadline:            *deadline,
+		AuditImports:        *auditImports,
+		NoNewImports:        *noNewImports,
+		Rewrite:             rewrite,
+		NoConfigFile:        *noConfig,
+	}
+	// Flags left at their default leave the option to .fsplit.toml, which the defaults of the options also apply after,
+	// and flags given on the command line win over the file even if they are set to the zero value
+	setFlags := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+	if setFlags["split-above"] {
+		setFlags["min-funcs"] = true
+	}
+	if !setFlags["suffix"] {
+		opts.Suffix = ""
+	}
+	if !setFlags["min-funcs"] {
+		opts.MinFuncs = 0
+	}
+	for _, key := range []string{"suffix", "min-funcs", "max-funcs", "include", "exclude", "skip"} {
+		if setFlags[key] {
+			opts.Explicit = append(opts.Explicit, key)
+		}
+	}
+	if *normalizeImportsOnly {
+		if _, err := fsplit.NormalizeImports(packagePath, opts); err != nil {
+			log.Fatalf("Error normalizing imports: %v\n", err)
+		}
+		return
+	}
+
+	if *list {
+		plan, err := fsplit.PlanFsplit(packagePath, opts)
+		if err != nil {
+			log.Fatalf("Error running fsplit: %v\n", err)
+		}
+		printSplitFiles(plan)
+		return
+	}
+
+	if *stdout {
+		if info, err := os.Stat(packagePath); err == nil && info.IsDir() {
+			log.Fatalln("Error: -stdout requires a single .go file")
+		}
+		plan, err := fsplit.PlanFsplit(packagePath, opts)
+		if err != nil {
+			log.Fatalf("Error running fsplit: %v\n", err)
+		}
+		printCreatedFiles(plan)
+		return
+	}
+
+	if *jsonPlan != "" {
+		plan, err := fsplit.PlanFsplit(packagePath, opts)
+		if err != nil {
+			log.Fatalf("Error planning fsplit: %v\n", err)
+		}
+		data, err := plan.JSON()
+		if err != nil {
+			log.Fatalf("Error creating plan: %v\n", err)
+		}
+		if err := os.WriteFile(*jsonPlan, data, 0644); err != nil {
+			log.Fatalf("Error writing plan: %v\n", err)
+		}
+		return
+	}
+
+	root, ok := strings.CutSuffix(packagePath, "/...")
+	if ok && root == "" {
+		root = "/"
+	}
+	if ok || *recursive {
+		packagePath, *recursive = root, true
+	}
+
+	if *check {
+		var files []string
+		if *recursive {
+			files, err = fsplit.CheckRecursive(packagePath, opts)
+		} else {
+			files, err = fsplit.Check(packagePath, opts)
+		}
+		if err != nil {
+			log.Fatalf("Error checking: %v\n", err)
+		}
+		for _, file := range files {
+			fmt.Println(file)
+		}
+		if len(files) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *dryRun {
+		opts.Verbose = true
+		cfg := fsplit.Config{PackagePath: packagePath, Recursive: *recursive, DryRun: true, Options: opts}
+		if err := fsplit.RunFsplitWithConfig(cfg); err != nil {
+			log.Fatalf("Error running fsplit: %v\n", err)
+		}
+		return
+	}
+
+	var result *fsplit.Result
+	var failed bool
+	if *fromStdin {
+		data, rerr := io.ReadAll(os.Stdin)
+		if rerr != nil {
+			log.Fatalf("Error reading paths: %v\n", rerr)
+		}
+		paths := readNames(data)
+		if len(paths) == 0 {
+			log.Fatalln("Error: -stdin read no paths")
+		}
+		packagePath = strings.Join(paths, ", ")
+		result, failed = runPaths(paths, opts)
+	} else if *fromGoList {
+		data, rerr := io.ReadAll(os.Stdin)
+		if rerr != nil {
+			log.Fatalf("Error reading packages: %v\n", rerr)
+		}
+		importPaths := readNames(data)
+		if len(importPaths) == 0 {
+			log.Fatalln("Error: -from-go-list read no packages from stdin")
+		}
+		packagePath = strings.Join(importPaths, ", ")
+		result, err = fsplit.RunFsplitImportPaths(importPaths, opts)
+	} else if *recursive {
+		result, err = fsplit.RunFsplitRecursive(packagePath, opts)
+	} else {
+		result, err = fsplit.RunFsplitWithOptions(packagePath, opts)
+	}
+	if err != nil {
 		log.Fatalf("Error running fsplit: %v\n", err)
 	}
+	if result.Unchanged() && len(result.Skipped) == 0 {
+		log.Printf("%s: package already split; nothing to do\n", packagePath)
+	}
+	if !*quiet {
+		fmt.Fprintln(os.Stderr, result.Summary())
+	}
+	if len(result.Skipped) > 0 {
+		log.Printf("Deadline passed, skipped %d packages: %s\n", len(result.Skipped), strings.Join(result.Skipped, ", "))
+	}
+
+	if *report == "markdown" {
+		fmt.Print(result.Markdown())
+	}
+
+	if *manifest != "" {
+		data, err := result.JSONManifest()
+		if err != nil {
+			log.Fatalf("Error creating manifest: %v\n", err)
+		}
+		if err := os.WriteFile(*manifest, data, 0644); err != nil {
+			log.Fatalf("Error writing manifest: %v\n", err)
+		}
+	}
+
+	if *auditImports {
+		fmt.Print(result.ImportsReport())
+		if result.HasUnexpectedImports() {
+			os.Exit(1)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// runPaths splits the packages or files at the paths one after another, merging their results
+// A path ending in /... is split recursively. A failure is logged and the remaining paths are still split,
+// so the paths split before and after it stay split. It reports whether any path failed.
+func runPaths(paths []string, opts fsplit.Options) (*fsplit.Result, bool) {
+	result := &fsplit.Result{}
+	failed := false
+	for _, path := range paths {
+		var r *fsplit.Result
+		var err error
+		if root, ok := strings.CutSuffix(path, "/..."); ok {
+			r, err = fsplit.RunFsplitRecursive(cmp.Or(root, "/"), opts)
+		} else {
+			r, err = fsplit.RunFsplitWithOptions(path, opts)
+		}
+		if err != nil {
+			log.Printf("Error running fsplit on %s: %v\n", path, err)
+			failed = true
+			continue
+		}
+		result.Merge(r)
+	}
+	return result, failed
+}
+
+// printSplitFiles prints the names of the original files split by the plan to stdout, one per line in sorted order
+func printSplitFiles(plan *fsplit.Plan) {
+	var sources []string
+	for _, entry := range plan.Manifest.Created {
+		if !slices.Contains(sources, entry.Source) {
+			sources = append(sources, entry.Source)
+		}
+	}
+	slices.Sort(sources)
+	for _, source := range sources {
+		fmt.Println(source)
+	}
+}
+
+// printCreatedFiles prints the files created by the plan to stdout, each after a banner with its name
+func printCreatedFiles(plan *fsplit.Plan) {
+	contents := make(map[string]string)
+	for _, w := range plan.Writes {
+		contents[w.File] = w.Content
+	}
+	for _, entry := range plan.Manifest.Created {
+		fmt.Printf("// === %s ===\n%s", entry.File, contents[entry.File])
+	}
+}
+
+// docTransform returns the doc comment transform enabled by the flags, or nil if there is none
+// Stale references are stripped before the note is appended.
+func docTransform(stripSeeAlso, docNote bool) fsplit.DocTransform {
+	var transforms []fsplit.DocTransform
+	if stripSeeAlso {
+		transforms = append(transforms, fsplit.StripSeeAlso)
+	}
+	if docNote {
+		transforms = append(transforms, fsplit.ExtractedNote)
+	}
+	if len(transforms) == 0 {
+		return nil
+	}
+	return func(funcName, source, doc string) string {
+		for _, transform := range transforms {
+			doc = transform(funcName, source, doc)
+		}
+		return doc
+	}
+}
+
+// readFuncNames reads the function names listed in the file, one per line
+// Blank lines and lines starting with # are ignored. It returns nil if no file is given.
+func readFuncNames(fileName string) ([]string, error) {
+	if fileName == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return readNames(data), nil
+}
+
+// readNames returns the lines of the data, ignoring blank lines and lines starting with #
+func readNames(data []byte) []string {
+	names := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			names = append(names, line)
+		}
+	}
+	return names
+}
+
+// compileRegexp compiles the expression, or returns nil if it is empty
+func compileRegexp(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	return regexp.Compile(expr)
 }
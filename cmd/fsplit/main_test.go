@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fsplitBin is the fsplit command built by TestMain
+var fsplitBin string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "fsplit")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fsplitBin = filepath.Join(dir, "fsplit")
+	if out, err := exec.Command("go", "build", "-o", fsplitBin, ".").CombinedOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error building fsplit: %v\n%s", err, out)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// runCommand runs the fsplit command with the arguments and returns what it printed to stderr
+func runCommand(t *testing.T, args ...string) string {
+	t.Helper()
+	var stderr bytes.Buffer
+	cmd := exec.Command(fsplitBin, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("fsplit %s: %v\n%s", strings.Join(args, " "), err, stderr.String())
+	}
+	return stderr.String()
+}
+
+// writeFiles writes the files, keyed by their name relative to a new temporary directory, and returns the directory
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestAlreadySplit(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"a.go": "package p\n\nfunc A() {}\n\nfunc B() {}\n"})
+	if stderr := runCommand(t, "-no-config", dir); strings.Contains(stderr, "already split") {
+		t.Fatalf("the first run reported the package already split:\n%s", stderr)
+	}
+
+	// Back-date the files so that a rewrite on the second run would show in their modification times
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, entry := range entries {
+		if err := os.Chtimes(filepath.Join(dir, entry.Name()), past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stderr := runCommand(t, "-no-config", dir)
+	if want := dir + ": package already split; nothing to do"; !strings.Contains(stderr, want) {
+		t.Errorf("stderr =\n%s\nwant it to contain %q", stderr, want)
+	}
+	for _, entry := range entries {
+		info, err := os.Stat(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(past) {
+			t.Errorf("%s was written by the second run", entry.Name())
+		}
+	}
+	if after, err := os.ReadDir(dir); err != nil || len(after) != len(entries) {
+		t.Errorf("the second run left %d files, want the %d of the first (%v)", len(after), len(entries), err)
+	}
+}
+
+func TestFuncsFrom(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"a.go": "package p\n\ntype T struct{}\n\nfunc A() {}\n\nfunc (T) M() {}\n\nfunc B() {}\n"})
+	names := filepath.Join(t.TempDir(), "names.txt")
+	if err := os.WriteFile(names, []byte("# split these\nA\n\n  T.M  \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runCommand(t, "-no-config", "-funcs-from", names, dir)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, entry := range entries {
+		got = append(got, entry.Name())
+	}
+	if want := []string{"a.T.M.fsplit.go", "a._.A.fsplit.go", "a.go"}; !slices.Equal(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+}
+
+func TestFlagsOverConfigFile(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"file", nil, []string{".fsplit.toml", "a.go"}},
+		{"zero value", []string{"-max-funcs", "0"}, []string{".fsplit.toml", "a._.A.gen.go", "a._.B.gen.go", "a.go"}},
+		{"default value", []string{"-max-funcs", "0", "-suffix", "fsplit"}, []string{".fsplit.toml", "a._.A.fsplit.go", "a._.B.fsplit.go", "a.go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, map[string]string{
+				".fsplit.toml": "max-funcs = 1\nsuffix = \"gen\"\n",
+				"a.go":         "package p\n\nfunc A() {}\n\nfunc B() {}\n",
+			})
+			runCommand(t, append(tt.args, dir)...)
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, entry := range entries {
+				got = append(got, entry.Name())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("files = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
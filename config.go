@@ -0,0 +1,70 @@
+package fsplit
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Config holds the package to split along with every option of the fsplit tool
+// The zero value of each field means the default, so new fields can be added without breaking callers.
+type Config struct {
+	// PackagePath is the package directory, or a single .go file of it
+	PackagePath string
+	// Recursive splits every package under PackagePath
+	Recursive bool
+	// DryRun computes the changes without making them
+	// With Options.Verbose, only the planned writes and removals are logged.
+	DryRun bool
+	// Summary receives the summary of the run, see Result.Summary, if set
+	// Nil means the library prints nothing. A dry run prints no summary either.
+	Summary io.Writer
+
+	Options
+}
+
+// RunFsplitWithConfig runs the fsplit tool as configured
+func RunFsplitWithConfig(cfg Config) error {
+	return RunFsplitWithConfigContext(context.Background(), cfg)
+}
+
+// RunFsplitWithConfigContext runs the fsplit tool as configured
+// If ctx is canceled, it returns promptly. The changes to a package are staged in memory and only written
+// once its split succeeded, so the package being split is left untouched. With Config.Recursive,
+// the packages split before the cancellation stay split.
+// If Config.Summary is set, it prints a summary of the run to it.
+func RunFsplitWithConfigContext(ctx context.Context, cfg Config) error {
+	opts := cfg.Options
+	var overlay *overlayFileSystem
+	if cfg.DryRun {
+		overlay = newOverlayFileSystem(opts.fileSystem())
+		opts.FileSystem = overlay
+		opts.Verbose = false
+	}
+
+	var result *Result
+	var err error
+	if cfg.Recursive {
+		result, err = RunFsplitRecursiveContext(ctx, cfg.PackagePath, opts)
+	} else {
+		result, err = RunFsplitWithOptionsContext(ctx, cfg.PackagePath, opts)
+	}
+	if err != nil {
+		return err
+	}
+	if overlay == nil {
+		if cfg.Summary != nil {
+			fmt.Fprintln(cfg.Summary, result.Summary())
+		}
+		return nil
+	}
+
+	plan := overlay.plan()
+	for _, w := range plan.Writes {
+		cfg.logf("would write %s", w.File)
+	}
+	for _, name := range plan.Removes {
+		cfg.logf("would remove %s", name)
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+package fsplit
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestConfigSummary(t *testing.T) {
+	dir := writePackage(t, map[string]string{"a.go": "package p\n\nfunc A() {}\n\nfunc B() {}\n"})
+	var summary bytes.Buffer
+	cfg := Config{PackagePath: dir, Summary: &summary, Options: Options{NoConfigFile: true}}
+	if err := RunFsplitWithConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if got := summary.String(); !strings.HasPrefix(got, "Split 1 files into 2 single-function files") {
+		t.Errorf("summary = %q", got)
+	}
+}
@@ -0,0 +1,218 @@
+package fsplit
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// configFileName is the name of the file setting defaults for the options of the packages under its directory
+const configFileName = ".fsplit.toml"
+
+// findConfigFile returns the name of the closest .fsplit.toml, searched upwards from the directory
+// The search stops at the root of the repository, which is the first directory containing .git,
+// or at the root of the file system. It returns "" if there is none.
+func findConfigFile(fsys FileSystem, dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		name := filepath.Join(dir, configFileName)
+		if _, err := fsys.Stat(name); err == nil {
+			return name, nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		if _, err := fsys.Stat(filepath.Join(dir, ".git")); err == nil || filepath.Dir(dir) == dir {
+			return "", nil
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// applyConfigFile sets the options left at their zero value from the closest .fsplit.toml of the package, if any
+// Options set by the caller, such as by flags, take precedence over the file, which takes precedence over the defaults.
+// Keys listed in Options.Explicit are left to the caller.
+func applyConfigFile(packagePath string, opts Options) (Options, error) {
+	fsys := opts.fileSystem()
+	dir := packagePath
+	if info, err := fsys.Stat(packagePath); err == nil && !info.IsDir() {
+		dir = filepath.Dir(packagePath)
+	}
+	fileName, err := findConfigFile(fsys, dir)
+	if err != nil || fileName == "" {
+		return opts, err
+	}
+	data, err := fsys.ReadFile(fileName)
+	if err != nil {
+		return opts, err
+	}
+	values, err := parseConfigFile(data)
+	if err != nil {
+		return opts, fmt.Errorf("Error reading %s: %v", fileName, err)
+	}
+	opts.logf("config %s", fileName)
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		value := values[key]
+		explicit := slices.Contains(opts.Explicit, key)
+		var err error
+		switch key {
+		case "suffix":
+			if !explicit && opts.Suffix == "" {
+				opts.Suffix, err = configString(value)
+			}
+		case "min-funcs":
+			if !explicit && opts.MinFuncs == 0 {
+				opts.MinFuncs, err = configInt(value)
+			}
+		case "max-funcs":
+			if !explicit && opts.MaxFuncs == 0 {
+				opts.MaxFuncs, err = configInt(value)
+			}
+		case "include":
+			if !explicit && opts.Include == nil {
+				opts.Include, err = configRegexp(value)
+			}
+		case "exclude":
+			if !explicit && opts.Exclude == nil {
+				opts.Exclude, err = configRegexp(value)
+			}
+		case "skip":
+			if !explicit && opts.Skip == nil {
+				opts.Skip, err = configStrings(value)
+			}
+		default:
+			err = fmt.Errorf("unknown key")
+		}
+		if err != nil {
+			return opts, fmt.Errorf("Error reading %s: %s: %v", fileName, key, err)
+		}
+	}
+	return opts, nil
+}
+
+// parseConfigFile parses the subset of TOML used by .fsplit.toml into raw values keyed by name
+// Every line is blank, a # comment or a key = value pair, where the value is a string, an integer
+// or an array of strings on one line. Tables are not supported.
+func parseConfigFile(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(stripConfigComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if _, ok := values[key]; ok {
+			return nil, fmt.Errorf("line %d: %s is set twice", n, key)
+		}
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
+
+// stripConfigComment removes a # comment from the line unless the # is inside of a string
+func stripConfigComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote == '"' && c == '\\':
+			// Skip the escaped character, which may be a quote
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// configString parses a basic "..." or literal '...' TOML string
+func configString(value string) (string, error) {
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		return value[1 : len(value)-1], nil
+	}
+	if strings.HasPrefix(value, `"`) {
+		return strconv.Unquote(value)
+	}
+	return "", fmt.Errorf("expected a string, got %s", value)
+}
+
+// configInt parses a TOML integer
+func configInt(value string) (int, error) {
+	n, err := strconv.Atoi(strings.ReplaceAll(value, "_", ""))
+	if err != nil {
+		return 0, fmt.Errorf("expected an integer, got %s", value)
+	}
+	return n, nil
+}
+
+// configRegexp parses a TOML string holding a regular expression
+func configRegexp(value string) (*regexp.Regexp, error) {
+	expr, err := configString(value)
+	if err != nil {
+		return nil, err
+	}
+	return regexp.Compile(expr)
+}
+
+// configStrings parses a TOML array of strings written on one line
+func configStrings(value string) ([]string, error) {
+	inner, hasPrefix := strings.CutPrefix(value, "[")
+	inner, hasSuffix := strings.CutSuffix(inner, "]")
+	if !hasPrefix || !hasSuffix {
+		return nil, fmt.Errorf("expected an array of strings, got %s", value)
+	}
+	strs := []string{}
+	for inner = strings.TrimSpace(inner); inner != ""; {
+		end := configStringEnd(inner)
+		if end < 0 {
+			return nil, fmt.Errorf("expected an array of strings, got %s", value)
+		}
+		s, err := configString(inner[:end])
+		if err != nil {
+			return nil, err
+		}
+		strs = append(strs, s)
+		inner = strings.TrimSpace(inner[end:])
+		inner = strings.TrimSpace(strings.TrimPrefix(inner, ","))
+	}
+	return strs, nil
+}
+
+// configStringEnd returns the offset right after the string at the start of s, or -1 if there is none
+func configStringEnd(s string) int {
+	if s == "" || (s[0] != '"' && s[0] != '\'') {
+		return -1
+	}
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[0] == '"' && s[i] == '\\':
+			i++
+		case s[i] == s[0]:
+			return i + 1
+		}
+	}
+	return -1
+}
@@ -0,0 +1,42 @@
+package fsplit
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestConfigFileExplicit(t *testing.T) {
+	files := map[string]string{
+		".git/HEAD":    "ref: refs/heads/main\n",
+		".fsplit.toml": "max-funcs = 1\ninclude = \"^A\"\nsuffix = \"gen\"\n",
+		"p/a.go":       "package p\n\nfunc A() {}\n\nfunc B() {}\n",
+	}
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		// max-funcs = 1 leaves the file of two functions alone
+		{"file", Options{}, []string{"p/a.go"}},
+		{"explicit zero values", Options{Explicit: []string{"max-funcs", "include"}}, []string{"p/a._.A.gen.go", "p/a._.B.gen.go", "p/a.go"}},
+		{"explicit suffix", Options{Suffix: "fsplit", Explicit: []string{"max-funcs", "suffix"}}, []string{"p/a._.A.fsplit.go", "p/a.go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := writePackage(t, files)
+			if _, err := RunFsplitWithOptions(filepath.Join(root, "p"), tt.opts); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, name := range fileNames(readPackage(t, root)) {
+				if name != ".git/HEAD" && name != ".fsplit.toml" {
+					got = append(got, name)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("files = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
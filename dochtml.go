@@ -0,0 +1,77 @@
+package fsplit
+
+import (
+	"bytes"
+	"go/ast"
+	"go/doc/comment"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"html"
+	"slices"
+	"strings"
+)
+
+// docHTMLFileName returns the name of the godoc HTML snippet written next to the generated file
+func docHTMLFileName(fileName string) string {
+	return strings.TrimSuffix(fileName, ".go") + ".html"
+}
+
+// writeDocHTML writes a godoc HTML snippet of the functions of every generated file next to it
+// The snippets are recorded in the result.
+func writeDocHTML(funcFiles []SingleFunctionFile, opts Options, result *Result) error {
+	fsys := opts.fileSystem()
+	var fileNames []string
+	for _, funcFile := range funcFiles {
+		if !slices.Contains(fileNames, funcFile.FileName) {
+			fileNames = append(fileNames, funcFile.FileName)
+		}
+	}
+
+	for _, fileName := range fileNames {
+		src, err := fsys.ReadFile(fileName)
+		if err != nil {
+			return err
+		}
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, fileName, src, parser.ParseComments)
+		if err != nil {
+			return err
+		}
+		content, err := docHTML(fset, file)
+		if err != nil {
+			return err
+		}
+		htmlName := docHTMLFileName(fileName)
+		if _, err := writeFileIfChanged(fsys, htmlName, content, 0644); err != nil {
+			return err
+		}
+		opts.logf("write %s", htmlName)
+		result.DocHTML = append(result.DocHTML, htmlName)
+	}
+	return nil
+}
+
+// docHTML renders the functions of the file like godoc does, each as a heading, its signature and its doc comment
+func docHTML(fset *token.FileSet, file *ast.File) ([]byte, error) {
+	var docParser comment.Parser
+	var docPrinter comment.Printer
+	var buf bytes.Buffer
+	for _, decl := range file.Decls {
+		funcDecl, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		name := qualifiedFuncName(funcDecl)
+		var sig bytes.Buffer
+		if err := printer.Fprint(&sig, fset, &ast.FuncDecl{Recv: funcDecl.Recv, Name: funcDecl.Name, Type: funcDecl.Type}); err != nil {
+			return nil, err
+		}
+		buf.WriteString("<h2 id=\"" + html.EscapeString(name) + "\">func " + html.EscapeString(name) + "</h2>\n")
+		buf.WriteString("<pre>" + html.EscapeString(sig.String()) + "</pre>\n")
+		if funcDecl.Doc != nil {
+			buf.Write(docPrinter.HTML(docParser.Parse(funcDecl.Doc.Text())))
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,20 @@
+package fsplit
+
+import "testing"
+
+func TestDocHTML(t *testing.T) {
+	dir := writePackage(t, map[string]string{"a.go": "package p\n\n// A returns the answer to <everything>\n//\n// It never fails.\nfunc A() int { return 42 }\n\nfunc B() {}\n"})
+	result, files := runFsplit(t, dir, Options{DocHTML: true})
+	want := map[string]string{
+		"a._.A.fsplit.html": "<h2 id=\"A\">func A</h2>\n<pre>func A() int</pre>\n<p>A returns the answer to &lt;everything&gt;\n<p>It never fails.\n",
+		"a._.B.fsplit.html": "<h2 id=\"B\">func B</h2>\n<pre>func B()</pre>\n",
+	}
+	for name, content := range want {
+		if files[name] != content {
+			t.Errorf("%s =\n%s\nwant\n%s", name, files[name], content)
+		}
+	}
+	if len(result.DocHTML) != 2 {
+		t.Errorf("DocHTML = %v, want both snippets", result.DocHTML)
+	}
+}
@@ -0,0 +1,65 @@
+package fsplit
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DocTransform rewrites the doc comment of an extracted function in its generated file
+// funcName is qualified as in SingleFunctionFile.FuncName, and source is the name of the original file.
+// doc is the doc comment as printed, one line per comment line without a trailing newline, or empty if there is none.
+// The returned comment replaces it, and an empty result removes it.
+type DocTransform func(funcName, source, doc string) string
+
+// ExtractedNote is a DocTransform appending a line noting the original file of the function
+// The line is placed before trailing //go: directives, which must stay last.
+func ExtractedNote(funcName, source, doc string) string {
+	note := fmt.Sprintf("// Extracted from %s by fsplit.", filepath.Base(source))
+	if doc == "" {
+		return note
+	}
+	lines := strings.Split(doc, "\n")
+	i := len(lines)
+	for i > 0 && strings.HasPrefix(lines[i-1], "//go:") {
+		i--
+	}
+	lines = append(lines[:i], append([]string{"//", note}, lines[i:]...)...)
+	return strings.Join(lines, "\n")
+}
+
+// seeAlsoPattern matches a doc comment line referring to a Go file, like "// See also foo.go."
+var seeAlsoPattern = regexp.MustCompile(`^//\s*See also \S+\.go\b`)
+
+// StripSeeAlso is a DocTransform removing "// See also foo.go" lines, which are stale once the function moved
+func StripSeeAlso(funcName, source, doc string) string {
+	var kept []string
+	for _, line := range strings.Split(doc, "\n") {
+		if !seeAlsoPattern.MatchString(line) {
+			kept = append(kept, line)
+		}
+	}
+	// Drop the empty comment lines separating the removed lines from the rest
+	for len(kept) > 0 && kept[len(kept)-1] == "//" {
+		kept = kept[:len(kept)-1]
+	}
+	return strings.Join(kept, "\n")
+}
+
+// transformDoc applies the transform to the doc comment of a printed function
+func transformDoc(funcSrc, funcName, source string, transform DocTransform) string {
+	if transform == nil {
+		return funcSrc
+	}
+	lines := strings.Split(funcSrc, "\n")
+	i := 0
+	for i < len(lines) && !strings.HasPrefix(lines[i], "func") {
+		i++
+	}
+	doc := transform(funcName, source, strings.Join(lines[:i], "\n"))
+	if doc == "" {
+		return strings.Join(lines[i:], "\n")
+	}
+	return strings.TrimSuffix(doc, "\n") + "\n" + strings.Join(lines[i:], "\n")
+}
@@ -0,0 +1,42 @@
+package fsplit
+
+import "testing"
+
+func TestDocTransforms(t *testing.T) {
+	tests := []struct {
+		name      string
+		transform DocTransform
+		doc       string
+		want      string
+	}{
+		{"note without doc", ExtractedNote, "", "// Extracted from a.go by fsplit."},
+		{"note", ExtractedNote, "// A does things", "// A does things\n//\n// Extracted from a.go by fsplit."},
+		{"note before directive", ExtractedNote, "// A does things\n//go:noinline", "// A does things\n//\n// Extracted from a.go by fsplit.\n//go:noinline"},
+		{"see also", StripSeeAlso, "// A does things\n//\n// See also b.go.", "// A does things"},
+		{"see also only", StripSeeAlso, "// See also b.go", ""},
+		{"no see also", StripSeeAlso, "// A does things\n// See also the docs.", "// A does things\n// See also the docs."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.transform("A", "/src/p/a.go", tt.doc); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocTransformSplit(t *testing.T) {
+	dir := writePackage(t, map[string]string{"a.go": "package p\n\n// A does things\n//\n// See also b.go.\nfunc A() {}\n\nfunc B() {}\n"})
+	_, files := runFsplit(t, dir, Options{DocTransform: StripSeeAlso})
+	want := "// Code generated by fsplit from a.go; DO NOT EDIT.\n\npackage p\n\n// A does things\nfunc A() {}\n"
+	if files["a._.A.fsplit.go"] != want {
+		t.Errorf("a._.A.fsplit.go =\n%s\nwant\n%s", files["a._.A.fsplit.go"], want)
+	}
+	// Removing the whole doc comment leaves the function alone
+	dir = writePackage(t, map[string]string{"a.go": "package p\n\n// A does things\nfunc A() {}\n\nfunc B() {}\n"})
+	_, files = runFsplit(t, dir, Options{DocTransform: func(funcName, source, doc string) string { return "" }})
+	want = "// Code generated by fsplit from a.go; DO NOT EDIT.\n\npackage p\n\nfunc A() {}\n"
+	if files["a._.A.fsplit.go"] != want {
+		t.Errorf("a._.A.fsplit.go =\n%s\nwant\n%s", files["a._.A.fsplit.go"], want)
+	}
+}
@@ -0,0 +1,148 @@
+package fsplit
+
+import (
+	"bytes"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"slices"
+)
+
+// exclusiveVars returns the variable declarations of the package that move with a function by Options.MoveExclusiveVars,
+// keyed by the function
+// A declaration moves if all of its variables are unexported and the function is the only top-level declaration
+// of the package referring to any of them. It must be in the file of the function, so that the imports it needs are copied too.
+// Names are matched without type information, so a field or local variable of the same name elsewhere keeps it in place.
+// Files in created, which were created by this run, and the unsplit files behind the negated Options.BuildTag are ignored,
+// since they declare the same variables.
+func exclusiveVars(pkg *ast.Package, created map[string]bool, opts Options) map[*ast.FuncDecl][]*ast.GenDecl {
+	var fileNames []string
+	for _, fileName := range sortedFileNames(pkg) {
+		if !created[fileName] && !(opts.buildTag != nil && isUnsplitFileName(fileName, opts.splitSuffix())) {
+			fileNames = append(fileNames, fileName)
+		}
+	}
+
+	// vars maps the names of the candidate variables to their declaration
+	vars := make(map[string]*ast.GenDecl)
+	declFiles := make(map[ast.Decl]*ast.File)
+	for _, fileName := range fileNames {
+		file := pkg.Files[fileName]
+		for _, decl := range file.Decls {
+			declFiles[decl] = file
+			if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.VAR && isUnexportedVarDecl(gen) {
+				for _, spec := range gen.Specs {
+					for _, name := range spec.(*ast.ValueSpec).Names {
+						vars[name.Name] = gen
+					}
+				}
+			}
+		}
+	}
+	if len(vars) == 0 {
+		return nil
+	}
+
+	users := make(map[*ast.GenDecl][]ast.Decl)
+	for _, fileName := range fileNames {
+		for _, decl := range pkg.Files[fileName].Decls {
+			ast.Inspect(decl, func(n ast.Node) bool {
+				ident, ok := n.(*ast.Ident)
+				if !ok {
+					return true
+				}
+				if gen, ok := vars[ident.Name]; ok && gen != decl && !slices.Contains(users[gen], decl) {
+					users[gen] = append(users[gen], decl)
+				}
+				return true
+			})
+		}
+	}
+
+	exclusive := make(map[*ast.FuncDecl][]*ast.GenDecl)
+	for _, fileName := range fileNames {
+		for _, decl := range pkg.Files[fileName].Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || len(users[gen]) != 1 {
+				continue
+			}
+			if funcDecl, ok := users[gen][0].(*ast.FuncDecl); ok && declFiles[funcDecl] == declFiles[gen] {
+				exclusive[funcDecl] = append(exclusive[funcDecl], gen)
+			}
+		}
+	}
+	return exclusive
+}
+
+// isUnexportedVarDecl checks if every variable of the declaration is unexported and named
+func isUnexportedVarDecl(gen *ast.GenDecl) bool {
+	for _, spec := range gen.Specs {
+		for _, name := range spec.(*ast.ValueSpec).Names {
+			if name.IsExported() || name.Name == "_" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// varNames returns the names of the variables of the declarations
+func varNames(gens []*ast.GenDecl) []string {
+	var names []string
+	for _, gen := range gens {
+		for _, spec := range gen.Specs {
+			for _, name := range spec.(*ast.ValueSpec).Names {
+				names = append(names, name.Name)
+			}
+		}
+	}
+	return names
+}
+
+// printVars prints the declarations with their comments, each followed by a blank line, as they are written above their function
+// The printer keeps a comment on the line a declaration ends on, which removeVarsFromFile removes along with it.
+func printVars(buf *bytes.Buffer, fset *token.FileSet, file *ast.File, gens []*ast.GenDecl) error {
+	for _, gen := range gens {
+		if err := printer.Fprint(buf, fset, &printer.CommentedNode{Node: gen, Comments: file.Comments}); err != nil {
+			return err
+		}
+		buf.WriteString("\n\n")
+	}
+	return nil
+}
+
+// lineComment returns the comment following the declaration on the line it ends on, or nil
+func lineComment(fset *token.FileSet, file *ast.File, gen *ast.GenDecl) *ast.CommentGroup {
+	line := fset.Position(gen.End()).Line
+	for _, comment := range file.Comments {
+		if comment.Pos() >= gen.End() && fset.Position(comment.Pos()).Line == line {
+			return comment
+		}
+	}
+	return nil
+}
+
+// removeVarsFromFile removes the declarations from the file along with their comments
+func removeVarsFromFile(fset *token.FileSet, file *ast.File, gens []*ast.GenDecl) {
+	moved := make(map[*ast.CommentGroup]bool)
+	for _, gen := range gens {
+		if gen.Doc != nil {
+			moved[gen.Doc] = true
+		}
+		if comment := lineComment(fset, file, gen); comment != nil {
+			moved[comment] = true
+		}
+		for _, comment := range file.Comments {
+			if gen.Pos() <= comment.Pos() && comment.Pos() < gen.End() {
+				moved[comment] = true
+			}
+		}
+	}
+	file.Comments = slices.DeleteFunc(file.Comments, func(comment *ast.CommentGroup) bool {
+		return moved[comment]
+	})
+	file.Decls = slices.DeleteFunc(file.Decls, func(decl ast.Decl) bool {
+		gen, ok := decl.(*ast.GenDecl)
+		return ok && slices.Contains(gens, gen)
+	})
+}
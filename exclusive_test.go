@@ -0,0 +1,29 @@
+package fsplit
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMoveExclusiveVars(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"a.go": "package p\n\nvar only = 1\n\nvar shared = 2\n\nfunc A() int { return only + shared }\n\nfunc B() int { return shared }\n",
+	})
+	result, files := runFsplit(t, dir, Options{MoveExclusiveVars: true})
+	want := map[string]string{
+		"a.go":            "package p\n\nvar shared = 2\n",
+		"a._.A.fsplit.go": "// Code generated by fsplit from a.go; DO NOT EDIT.\n\npackage p\n\nvar only = 1\n\nfunc A() int { return only + shared }\n",
+		"a._.B.fsplit.go": "// Code generated by fsplit from a.go; DO NOT EDIT.\n\npackage p\n\nfunc B() int { return shared }\n",
+	}
+	for name, content := range want {
+		if files[name] != content {
+			t.Errorf("%s =\n%s\nwant\n%s", name, files[name], content)
+		}
+	}
+	if got := result.Files[0].Functions[0]; got.Name != "A" || !slices.Equal(got.Vars, []string{"only"}) {
+		t.Errorf("extracted %s with vars %v, want A with [only]", got.Name, got.Vars)
+	}
+	if err := typeCheck(t, dir); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,122 @@
+package fsplit
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// FileSystem is the file system fsplit reads the package from and writes the split files to
+// Names are paths as given to fsplit, joined with the OS path separator.
+type FileSystem interface {
+	// ReadFile returns the content of the file
+	ReadFile(name string) ([]byte, error)
+	// WriteFile writes the data to the file, creating it and its parent directories if necessary,
+	// and sets its permissions to perm
+	WriteFile(name string, data []byte, perm os.FileMode) error
+	// Stat returns the file info of the file
+	Stat(name string) (fs.FileInfo, error)
+	// Remove removes the file
+	Remove(name string) error
+	// ReadDir returns the entries of the directory sorted by name
+	ReadDir(name string) ([]fs.DirEntry, error)
+}
+
+// osFileSystem is the FileSystem backed by the operating system
+type osFileSystem struct{}
+
+func (osFileSystem) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+// WriteFile writes the data to the file and sets its permissions to perm
+// Unlike os.WriteFile, the permissions are applied to existing files as well and are not affected by umask.
+// Missing parent directories are created, which is needed to write into Options.OutDir.
+func (osFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(name, data, perm); err != nil {
+		return err
+	}
+	return os.Chmod(name, perm)
+}
+
+func (osFileSystem) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osFileSystem) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (osFileSystem) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+// fileSystem returns the file system to use, defaulting to the operating system
+func (opts Options) fileSystem() FileSystem {
+	if opts.FileSystem == nil {
+		return osFileSystem{}
+	}
+	return opts.FileSystem
+}
+
+// parseDir parses every Go file in the directory like parser.ParseDir, but reads them from fsys
+func parseDir(fset *token.FileSet, fsys FileSystem, dir string, mode parser.Mode) (map[string]*ast.Package, error) {
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	pkgs := make(map[string]*ast.Package)
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".go" {
+			continue
+		}
+		fileName := filepath.Join(dir, entry.Name())
+		src, err := fsys.ReadFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+		file, err := parser.ParseFile(fset, fileName, src, mode)
+		if err != nil {
+			return nil, err
+		}
+		name := file.Name.Name
+		pkg, ok := pkgs[name]
+		if !ok {
+			pkg = &ast.Package{Name: name, Files: make(map[string]*ast.File)}
+			pkgs[name] = pkg
+		}
+		pkg.Files[fileName] = file
+	}
+	return pkgs, nil
+}
+
+// sortedPackages returns the packages parsed by parseDir ordered by name
+func sortedPackages(pkgs map[string]*ast.Package) []*ast.Package {
+	sorted := make([]*ast.Package, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		sorted = append(sorted, pkg)
+	}
+	slices.SortFunc(sorted, func(a, b *ast.Package) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return sorted
+}
+
+// sortedFileNames returns the names of the files of the package in lexical order
+func sortedFileNames(pkg *ast.Package) []string {
+	fileNames := make([]string, 0, len(pkg.Files))
+	for fileName := range pkg.Files {
+		fileNames = append(fileNames, fileName)
+	}
+	slices.Sort(fileNames)
+	return fileNames
+}
@@ -0,0 +1,66 @@
+package fsplit
+
+import (
+	"io/fs"
+	"os"
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+// memFileSystem is a FileSystem keeping the files in memory, keyed by slash-separated relative paths
+type memFileSystem struct {
+	fstest.MapFS
+}
+
+func (m memFileSystem) ReadDir(name string) ([]fs.DirEntry, error) {
+	return m.MapFS.ReadDir(name)
+}
+
+func (m memFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	m.MapFS[name] = &fstest.MapFile{Data: data, Mode: perm}
+	return nil
+}
+
+func (m memFileSystem) Remove(name string) error {
+	if _, ok := m.MapFS[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(m.MapFS, name)
+	return nil
+}
+
+func TestMemFileSystem(t *testing.T) {
+	fsys := memFileSystem{fstest.MapFS{
+		"p/a.go": {Data: []byte("package p\n\nimport \"fmt\"\n\nconst x = 1\n\nfunc A() { fmt.Println(x) }\n\nfunc B() {}\n"), Mode: 0644},
+	}}
+	result, err := RunFsplitWithOptions("p", Options{FileSystem: fsys, Verify: true, NoConfigFile: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.CreatedFiles() != 2 {
+		t.Errorf("created %d files, want 2", result.CreatedFiles())
+	}
+
+	var names []string
+	for name := range fsys.MapFS {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	if want := []string{"p/a._.A.fsplit.go", "p/a._.B.fsplit.go", "p/a.go"}; !slices.Equal(names, want) {
+		t.Fatalf("files = %v, want %v", names, want)
+	}
+	want := map[string]string{
+		"p/a.go":            "package p\n\nconst x = 1\n",
+		"p/a._.A.fsplit.go": "// Code generated by fsplit from a.go; DO NOT EDIT.\n\npackage p\n\nimport \"fmt\"\n\nfunc A() { fmt.Println(x) }\n",
+		"p/a._.B.fsplit.go": "// Code generated by fsplit from a.go; DO NOT EDIT.\n\npackage p\n\nfunc B() {}\n",
+	}
+	for name, content := range want {
+		if got := string(fsys.MapFS[name].Data); got != content {
+			t.Errorf("%s =\n%s\nwant\n%s", name, got, content)
+		}
+	}
+	if _, err := os.Stat("p"); err == nil {
+		t.Error("the split was written to disk")
+	}
+}
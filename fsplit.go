@@ -2,41 +2,657 @@ package fsplit
 
 import (
 	"bytes"
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
 	"go/ast"
+	"go/build/constraint"
 	"go/parser"
 	"go/printer"
 	"go/token"
+	"log"
 	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
 	"strings"
+	"time"
 
-	"golang.org/x/tools/imports"
+	"golang.org/x/sync/errgroup"
 )
 
-// RunFsplit runs the fsplit tool
+// Options holds the options of the fsplit tool
+type Options struct {
+	// Verbose enables logging of every action
+	Verbose bool
+	// Layout decides which functions are split into their own files
+	Layout Layout
+	// Skip are glob patterns of files that are not split, matched against the base name of each file
+	// They support the syntax of filepath.Match, such as "*" and "?".
+	Skip []string
+	// ExportedOnly extracts only exported functions and methods
+	// Unexported ones stay in the original file.
+	ExportedOnly bool
+	// MinFuncs is the minimum number of functions a file must have to be split
+	// Values below 2 mean 2, since splitting a single function file is pointless.
+	MinFuncs int
+	// MaxFuncs is the maximum number of functions a file may have to be split
+	// Files with more functions are probably generated or special and are skipped. Zero means no limit.
+	MaxFuncs int
+	// Include extracts only functions whose name matches, if set
+	// Methods are named with their receiver type name (e.g. "T.Method").
+	Include *regexp.Regexp
+	// Exclude keeps functions whose name matches in the original file, if set
+	Exclude *regexp.Regexp
+	// Funcs extracts only the functions with these names, if set
+	// Methods are named with their receiver type name (e.g. "T.Method").
+	Funcs []string
+	// Signature extracts only functions with this signature, like "func(context.Context) error", if set
+	// Parameter names and receivers are ignored, so methods match by their signature without the receiver.
+	Signature string
+	// MinLines extracts only functions spanning at least this many source lines
+	// Smaller functions stay in the original file. Zero means no limit.
+	MinLines int
+	// ChangedSince extracts only functions whose lines changed since this git ref
+	// Unchanged functions stay in the original file. The package must be in a git repository.
+	ChangedSince string
+	// IncludeTests enables splitting of test files
+	IncludeTests bool
+	// KeepTestMain keeps TestMain in its original test file
+	KeepTestMain bool
+	// SkipExamples keeps example functions in their original test file
+	SkipExamples bool
+	// FileMapping maps function names to the file they are extracted into, relative to the package directory
+	// Methods are named with their receiver type name (e.g. "T.Method").
+	// If the file already exists, the function is appended to it. Unmapped functions use the default file name.
+	// Created files are only marked as generated if their name ends with the split suffix, like foo.fsplit.go.
+	FileMapping map[string]string
+	// PathNames prefixes the names of generated files with a path so that related functions cluster
+	// The path comes from a "//fsplit:path a/b" marker in the function's doc comment or before the package clause,
+	// or from the build constraint of the file. It is flattened with dots (e.g. a.b.foo._.Bar.fsplit.go).
+	PathNames bool
+	// QualifyNames prefixes the names of generated files with the package name (e.g. pkg.foo._.Bar.fsplit.go)
+	// so that they are unique across packages.
+	QualifyNames bool
+	// ConstructorWithType keeps constructors named New<T> or new<T> with the declaration of type T
+	// instead of splitting them, moving them into the file defining T if necessary.
+	ConstructorWithType bool
+	// MoveExclusiveVars moves the declarations of unexported package-level variables only one extracted function uses,
+	// such as a regexp compiled once, from its original file into its generated file, above the function.
+	// It cannot be combined with RemoveOnly.
+	MoveExclusiveVars bool
+	// CommentAssociation decides which comments around a function move with it
+	// Empty means CommentsAdjacent.
+	CommentAssociation CommentAssociation
+	// DetachedDocLines treats a comment separated from the following function by at most this many blank lines
+	// as its doc comment, so that it moves with the function. Zero means only real doc comments move.
+	DetachedDocLines int
+	// GroupInits collects the init functions of the package into a single init.fsplit.go file in declaration order
+	// Init functions of files with build constraints are split as usual, since the constraint applies to the whole file.
+	GroupInits bool
+	// KeepOne keeps one function in every split original file so that it stays meaningful
+	// It is the function with this name, with methods named Type.Method, or the first function of the file if it has none,
+	// so "first" keeps the first function. Empty means every function is split.
+	KeepOne string
+	// CatchAll gathers the functions shorter than MinLines into a single <CatchAll>.fsplit.go file
+	// instead of leaving them in their original files. Empty means they stay in place.
+	CatchAll string
+	// PackLines packs consecutive functions of an original file into one generated file, named like foo.pack1.fsplit.go,
+	// until adding the next function would make the functions of the file span more than this many lines.
+	// Functions longer than that get a file of their own. Zero means one function per file.
+	PackLines int
+	// MaxFileLines is the maximum number of lines a generated file may have
+	// It catches accidental over-grouping into the catch-all, init or mapped files. Zero means no limit.
+	MaxFileLines int
+	// DocTransform rewrites the doc comments of extracted functions in their generated files, if set
+	// The original files are not affected.
+	DocTransform DocTransform
+	// SortByName orders functions gathered into one file by name
+	// By default they keep their source order, ordered by file name and then position.
+	SortByName bool
+	// Order prefixes the names of generated files with the position of the function in the original file
+	// so that the generated files sort in declaration order.
+	Order bool
+	// Suffix is the suffix of generated file names before the extension, as in foo._.Bar.<Suffix>.go
+	// Empty means "fsplit".
+	Suffix string
+	// OutDir writes the generated files into this existing directory instead of the package directory
+	// The original files are left untouched, since the package would otherwise lose the functions.
+	OutDir string
+	// ModuleRelative writes the generated files under OutDir at the path of the package relative to its module root,
+	// which is the closest directory containing go.mod, so that the output mirrors the source tree.
+	ModuleRelative bool
+	// FlatNames decides how the generated files written into OutDir are named
+	// Empty means FlatNamesReadable.
+	FlatNames FlatNames
+	// Subdirs is an experimental layout that writes single function files into a subdirectory per receiver type,
+	// or "_" for functions, instead of next to the original file. Files gathering functions stay in place.
+	// Go builds every directory as its own package, so the result needs further work to compile.
+	Subdirs bool
+	// SubPackage moves the exported functions that refer to no other package-level name into the sub-package
+	// <pkg>/fsplit, one file each, and keeps forwarders calling them in the generated files of the package,
+	// so that its API is unchanged. The package must be in a module. It cannot be combined with OutDir, Subdirs,
+	// BuildTag, RemoveOnly or VerifyReversible.
+	SubPackage bool
+	// GoGenerate adds a "//go:generate fsplit ." directive to the package so that go generate re-runs the split
+	// It is added once, after the package clause, unless the package already has one.
+	GoGenerate bool
+	// GoGenerateFile is the file, relative to the package directory, to add the directive to
+	// Empty means the file with the package doc comment, or the first original file.
+	GoGenerateFile string
+	// DocHTML writes a godoc HTML snippet of the functions of every generated file next to it,
+	// named like the file with .html instead of .go, for documentation sites.
+	DocHTML bool
+	// BuildTag puts every generated file behind this build tag and keeps the functions split from each original file
+	// in a <stem>.unsplit.fsplit.go file behind its negation, so that either variant can be built, e.g. for A/B comparisons.
+	// It cannot be combined with OutDir or Subdirs.
+	BuildTag string
+	// Header is prepended to every generated file, before the "Code generated" line, such as a license header
+	// It must consist of comments only. Rewritten original files do not get it.
+	Header string
+	// Index writes fsplit.index.go declaring FsplitIndex, a map from every function in the files generated by fsplit,
+	// with methods named Type.Method, to the base name of its file, for other generators of the package.
+	// The file is marked as generated, so it is not split. It is not written with OutDir.
+	Index bool
+	// CaseSafeNames appends -2, -3 and so on to the function part of single function file names
+	// that differ from an earlier one only by case, such as the methods of types Foo and foo,
+	// so that they do not collide on case-insensitive file systems.
+	// Otherwise they are written as they are, which only works on case-sensitive file systems.
+	CaseSafeNames bool
+	// RemainingSuffix renames split original files to <stem>.<RemainingSuffix>.go
+	// so that they read as the non-function residue. Empty means the name is kept.
+	RemainingSuffix string
+	// RemoveEmpty decides what happens to original files that have nothing left after splitting
+	RemoveEmpty RemoveEmpty
+	// RemoveOnly skips extraction and only removes the functions whose generated files already exist
+	// The functions are identified by the names of the generated files in the package directory, like foo.T.Method.fsplit.go.
+	// This completes a split whose generated files were put into the package earlier, for example by ExtractFunctions
+	// or by copying them from OutDir. It cannot be combined with OutDir.
+	RemoveOnly bool
+	// NoConfigFile ignores .fsplit.toml files
+	// Otherwise the closest one above the package, up to the root of the repository, sets the options left at their zero value:
+	// suffix, min-funcs, max-funcs, include, exclude and skip.
+	NoConfigFile bool
+	// Explicit are the keys of .fsplit.toml, such as max-funcs, whose options the caller set on purpose
+	// The file does not override them even if they are at their zero value, like a flag given as -max-funcs 0.
+	Explicit []string
+	// Force allows modifying packages under GOROOT and splitting cgo files
+	// The cgo preamble is copied to every file split from a cgo file, and //export directives move with their function.
+	Force bool
+	// Verify re-parses every written file after splitting
+	// and checks that every top-level symbol is still declared exactly as often as before.
+	// If any check fails, all changes are rolled back.
+	Verify bool
+	// VerifyReversible joins the split files back in memory after splitting and checks that this reproduces
+	// the declarations of every original file, comments included, up to gofmt and imports.
+	// If it does not, as with DocTransform or Rewrite, nothing is changed. It cannot be combined with OutDir.
+	VerifyReversible bool
+	// RunTests runs go test on the package after splitting and rolls all changes back if the tests fail
+	// It is skipped when the changes are not written to disk, as in a dry run.
+	RunTests bool
+	// Format is the formatter of generated and rewritten files
+	// Empty means FormatGoimports.
+	Format Format
+	// SingleImportGroup collapses the import groups of generated files into a single sorted group
+	SingleImportGroup bool
+	// NoIgnore makes RunFsplitRecursive descend into vendor, testdata, dot and underscore directories
+	// and directories ignored by .gitignore files, which are skipped by default.
+	NoIgnore bool
+	// Rewrite are gofmt -r rules like "a[b:len(a)] -> a[b:]" applied to generated files in order,
+	// so that they match a project formatting with such rules.
+	Rewrite []string
+	// NoNewImports fails instead of writing a generated file that goimports gave an import
+	// none of its original files has, which would mean an identifier was resolved to a different package.
+	NoNewImports bool
+	// AuditImports compares the imports of every generated file with those of its original files
+	// and records the outcome in Result.ImportAudit.
+	AuditImports bool
+	// Deadline stops RunFsplitRecursive from starting new packages once this much time has passed
+	// The package being split when it passes is finished. Zero means no deadline.
+	Deadline time.Duration
+	// OnProgress is called after each file is staged, if set
+	// Generated files are reported first and then the rewritten original files,
+	// each phase counting from 1 to its own total. Staged files are only written to the
+	// file system once the whole run succeeded, so a reported file may still be rolled back.
+	OnProgress func(done, total int, currentFile string)
+	// FileSystem is the file system the package is read from and written to
+	// Nil means the file system of the operating system.
+	FileSystem FileSystem
+
+	// outSubdir is the directory under Options.OutDir the generated files are written to
+	outSubdir string
+	// importPath is the import path of the package, which Options.FlatNames hashes and Options.SubPackage imports from
+	importPath string
+	// onlyFile restricts splitting to this file when fsplit is given a single file instead of a directory
+	onlyFile string
+	// signature is Options.Signature normalized by prepare
+	signature string
+	// funcs is the set of Options.Funcs built by prepare
+	funcs map[string]bool
+	// buildTag is Options.BuildTag parsed by prepare
+	buildTag *constraint.TagExpr
+	// changed are the lines changed since Options.ChangedSince, keyed by file name
+	changed map[string][]lineRange
+	// split are the functions with generated files for Options.RemoveOnly
+	split splitFunctions
+}
+
+// RunFsplit runs the fsplit tool with the default options
 // It extracts functions from the package, creates single function files,
 // and removes functions from the original files
 func RunFsplit(packagePath string) error {
-	funcFiles, err := extractFunctions(packagePath)
+	return RunFsplitWithConfig(Config{PackagePath: packagePath})
+}
+
+// RunFsplitContext runs the fsplit tool with the default options
+// If ctx is canceled, it returns promptly without changing anything.
+func RunFsplitContext(ctx context.Context, packagePath string) error {
+	return RunFsplitWithConfigContext(ctx, Config{PackagePath: packagePath})
+}
+
+// RunFsplitWithOptions runs the fsplit tool with the given options
+// It returns the result describing the split files
+func RunFsplitWithOptions(packagePath string, opts Options) (*Result, error) {
+	return RunFsplitWithOptionsContext(context.Background(), packagePath, opts)
+}
+
+// RunFsplitWithOptionsContext runs the fsplit tool with the given options
+// packagePath is either a package directory or a single .go file of it.
+// In the latter case, only that file is split and the other files of the package are left untouched.
+// Every change is staged in memory and only written once the whole run succeeded,
+// so a failed or canceled run leaves the package as it was. ctx is checked between files.
+func RunFsplitWithOptionsContext(ctx context.Context, packagePath string, opts Options) (*Result, error) {
+	packagePath, opts, err := prepare(packagePath, opts)
 	if err != nil {
-		return fmt.Errorf("Error detecting and extracting functions: %v", err)
+		return nil, err
 	}
+	fsys := opts.fileSystem()
 
-	if err := createSingleFunctionFiles(funcFiles); err != nil {
-		return fmt.Errorf("Error creating single function files: %v", err)
+	var snap snapshot
+	var symbols map[string]int
+	if opts.RunTests {
+		if snap, err = takeSnapshot(fsys, packagePath); err != nil {
+			return nil, fmt.Errorf("Error taking snapshot: %v", err)
+		}
+	}
+	if opts.Verify {
+		if symbols, err = symbolCounts(fsys, packagePath); err != nil {
+			return nil, fmt.Errorf("Error collecting symbols: %v", err)
+		}
 	}
 
-	if err = removeFunctions(packagePath); err != nil {
-		return fmt.Errorf("Error removing functions: %v", err)
+	staged := newOverlayFileSystem(fsys)
+	opts.FileSystem = staged
+	result, err := stageFsplit(ctx, packagePath, opts)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	if opts.Verify {
+		err := verifyFiles(staged, result.writtenFiles())
+		if err == nil {
+			var after map[string]int
+			// Functions are declared twice before a removal-only run and behind both sides of the build tag,
+			// so only the parse is checked
+			if after, err = symbolCounts(staged, packagePath); err == nil && !opts.RemoveOnly && opts.buildTag == nil {
+				err = compareSymbols(symbols, after)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error verifying split files, nothing was changed: %v", err)
+		}
+		opts.logf("verified %d files", len(result.writtenFiles()))
+	}
+
+	if opts.VerifyReversible {
+		if err := verifyReversible(fsys, staged, packagePath, opts, result); err != nil {
+			return nil, fmt.Errorf("Error verifying reversibility, nothing was changed: %v", err)
+		}
+		opts.logf("verified that joining reproduces %d files", len(result.Files))
+	}
+
+	if err := commitPlan(fsys, staged.plan()); err != nil {
+		return nil, fmt.Errorf("Error writing files, changes were rolled back: %v", err)
+	}
+
+	if opts.RunTests {
+		if _, ok := fsys.(osFileSystem); !ok {
+			opts.logf("skip running tests, since the changes are not on disk")
+		} else if err := goTest(ctx, packagePath); err != nil {
+			if rerr := snap.restore(fsys, result.changedFiles()); rerr != nil {
+				return nil, fmt.Errorf("Error running tests: %v (rollback failed: %v)", err, rerr)
+			}
+			return nil, fmt.Errorf("Error running tests, changes were rolled back: %v", err)
+		} else {
+			opts.logf("tests of %s passed", packagePath)
+		}
+	}
+
+	return result, nil
+}
+
+// stageFsplit splits the package prepared by prepare on the file system of opts
+// Errors leave the changes made so far in place, so the file system should be a staging overlay.
+func stageFsplit(ctx context.Context, packagePath string, opts Options) (*Result, error) {
+	var funcFiles, unsplit, sub []SingleFunctionFile
+	var names map[string]NameManifestEntry
+	var skipped map[string]int
+	if !opts.RemoveOnly {
+		var err error
+		if funcFiles, skipped, err = extractFunctions(ctx, packagePath, opts); err != nil {
+			return nil, fmt.Errorf("Error detecting and extracting functions: %w", err)
+		}
+		if opts.FlatNames == FlatNamesHash {
+			if names, err = hashFileNames(funcFiles, opts); err != nil {
+				return nil, fmt.Errorf("Error hashing file names: %v", err)
+			}
+		}
+		if opts.buildTag != nil {
+			unsplit = buildTagVariants(funcFiles, opts)
+		}
+		if opts.SubPackage {
+			if sub, err = subPackageVariants(funcFiles, opts); err != nil {
+				return nil, fmt.Errorf("Error moving functions into the sub-package: %v", err)
+			}
+		}
+		if _, err = createSingleFunctionFiles(ctx, slices.Concat(funcFiles, unsplit, sub), opts); err != nil {
+			return nil, fmt.Errorf("Error creating single function files: %w", err)
+		}
+	}
+
+	created := make(map[string]bool)
+	for _, funcFile := range funcFiles {
+		created[funcFile.FileName] = true
+	}
+	result := newResult(funcFiles)
+	result.SkippedFiles = skipped
+	for _, funcFile := range unsplit {
+		if !slices.Contains(result.Unsplit, funcFile.FileName) {
+			result.Unsplit = append(result.Unsplit, funcFile.FileName)
+		}
+	}
+	for _, funcFile := range sub {
+		result.SubPackage = append(result.SubPackage, funcFile.FileName)
+	}
+	if names != nil {
+		if err := writeNameManifest(names, opts, result); err != nil {
+			return nil, fmt.Errorf("Error writing name manifest: %v", err)
+		}
+	}
+	if opts.DocHTML {
+		if err := writeDocHTML(funcFiles, opts, result); err != nil {
+			return nil, fmt.Errorf("Error writing doc HTML: %v", err)
+		}
+	}
+	if opts.AuditImports {
+		var err error
+		if result.ImportAudit, err = auditImports(opts.fileSystem(), funcFiles); err != nil {
+			return nil, fmt.Errorf("Error auditing imports: %v", err)
+		}
+	}
+	if opts.OutDir != "" {
+		return result, nil
+	}
+	if err := removeFunctions(ctx, packagePath, opts, created, result); err != nil {
+		return nil, fmt.Errorf("Error removing functions: %w", err)
+	}
+	if opts.GoGenerate {
+		if err := addGenerateDirective(packagePath, opts, result); err != nil {
+			return nil, fmt.Errorf("Error adding go:generate directive: %v", err)
+		}
+	}
+	if opts.Index {
+		if err := writeIndex(packagePath, opts, result); err != nil {
+			return nil, fmt.Errorf("Error writing index: %v", err)
+		}
+	}
+	return result, nil
+}
+
+// ExtractFunctions extracts the functions to split from the package without writing anything
+// packagePath is either a package directory or a single .go file of it, as for RunFsplitWithOptions.
+// The returned files can be transformed and written by the caller before calling RemoveFunctions.
+func ExtractFunctions(ctx context.Context, packagePath string, opts Options) ([]SingleFunctionFile, error) {
+	packagePath, opts, err := prepare(packagePath, opts)
+	if err != nil {
+		return nil, err
+	}
+	funcFiles, _, err := extractFunctions(ctx, packagePath, opts)
+	return funcFiles, err
+}
+
+// RemoveFunctions removes the functions of funcFiles from their original files
+// funcFiles are the files returned by ExtractFunctions with the same options, which should be written by now.
+// It returns the result describing the split files.
+func RemoveFunctions(ctx context.Context, packagePath string, funcFiles []SingleFunctionFile, opts Options) (*Result, error) {
+	packagePath, opts, err := prepare(packagePath, opts)
+	if err != nil {
+		return nil, err
+	}
+	created := make(map[string]bool)
+	for _, funcFile := range funcFiles {
+		created[funcFile.FileName] = true
+	}
+	result := newResult(funcFiles)
+	if err := removeFunctions(ctx, packagePath, opts, created, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// prepare validates the options and resolves the package directory
+// It returns the package directory and the options completed with the state derived from them.
+func prepare(packagePath string, opts Options) (string, Options, error) {
+	if !opts.NoConfigFile {
+		var err error
+		if opts, err = applyConfigFile(packagePath, opts); err != nil {
+			return "", opts, err
+		}
+	}
+	if !opts.Layout.isValid() {
+		return "", opts, fmt.Errorf("Unknown layout: %q", opts.Layout)
+	}
+	if !opts.CommentAssociation.isValid() {
+		return "", opts, fmt.Errorf("Unknown comment association: %q", opts.CommentAssociation)
+	}
+	if !opts.FlatNames.isValid() {
+		return "", opts, fmt.Errorf("Unknown flat names: %q", opts.FlatNames)
+	}
+	if !opts.Format.isValid() {
+		return "", opts, fmt.Errorf("Unknown format: %q", opts.Format)
+	}
+	if !opts.RemoveEmpty.isValid() {
+		return "", opts, fmt.Errorf("Unknown remove-empty mode: %q", opts.RemoveEmpty)
+	}
+	for _, rule := range opts.Rewrite {
+		if _, err := parseRewriteRule(rule); err != nil {
+			return "", opts, err
+		}
+	}
+	for _, pattern := range opts.Skip {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return "", opts, fmt.Errorf("Invalid skip pattern %q: %v", pattern, err)
+		}
+	}
+
+	if opts.Header != "" {
+		if !strings.HasSuffix(opts.Header, "\n") {
+			opts.Header += "\n"
+		}
+		// The header ends up before the package clause, so anything but comments breaks the generated files
+		file, err := parser.ParseFile(token.NewFileSet(), "", opts.Header+"\npackage p\n", parser.ParseComments)
+		if err != nil || len(file.Comments) == 0 {
+			return "", opts, fmt.Errorf("Invalid header: it must consist of comments only")
+		}
+		opts.Header += "\n"
+	}
+	if opts.BuildTag != "" {
+		if opts.OutDir != "" || opts.Subdirs {
+			return "", opts, fmt.Errorf("The build tag cannot be combined with an output directory or subdirectories")
+		}
+		var err error
+		if opts.buildTag, err = parseBuildTag(opts.BuildTag); err != nil {
+			return "", opts, err
+		}
+	}
+	if opts.Funcs != nil {
+		opts.funcs = make(map[string]bool)
+		for _, name := range opts.Funcs {
+			opts.funcs[name] = true
+		}
+	}
+	if opts.Signature != "" {
+		var err error
+		if opts.signature, err = parseSignature(opts.Signature); err != nil {
+			return "", opts, err
+		}
+	}
+
+	fsys := opts.fileSystem()
+	packagePath, onlyFile, err := splitTarget(fsys, packagePath)
+	if err != nil {
+		return "", opts, err
+	}
+	opts.onlyFile = onlyFile
+	if opts.OutDir != "" {
+		if info, err := fsys.Stat(opts.OutDir); err != nil || !info.IsDir() {
+			return "", opts, fmt.Errorf("Output directory %s does not exist", opts.OutDir)
+		}
+	}
+	if opts.ModuleRelative {
+		if opts.OutDir == "" {
+			return "", opts, fmt.Errorf("Writing relative to the module root requires an output directory")
+		}
+		if opts.outSubdir, err = moduleRelativePath(fsys, packagePath); err != nil {
+			return "", opts, err
+		}
+	}
+	if opts.FlatNames == FlatNamesHash {
+		if opts.OutDir == "" {
+			return "", opts, fmt.Errorf("Hashing file names requires an output directory")
+		}
+		if opts.importPath, err = packageImportPath(fsys, packagePath); err != nil {
+			return "", opts, err
+		}
+	}
+	if opts.RemoveOnly && opts.OutDir != "" {
+		return "", opts, fmt.Errorf("Removing functions only is not possible with an output directory, since the original files are left untouched")
+	}
+	if opts.MoveExclusiveVars && opts.RemoveOnly {
+		return "", opts, fmt.Errorf("Moving exclusive variables is not possible when only removing functions")
+	}
+	if opts.VerifyReversible && opts.OutDir != "" {
+		return "", opts, fmt.Errorf("Verifying reversibility is not possible with an output directory, since the original files keep their functions")
+	}
+	if opts.SubPackage {
+		if opts.OutDir != "" || opts.Subdirs || opts.BuildTag != "" || opts.RemoveOnly || opts.VerifyReversible {
+			return "", opts, fmt.Errorf("The sub-package cannot be combined with an output directory, subdirectories, a build tag, removing functions only or verifying reversibility")
+		}
+		if _, _, err := moduleRoot(fsys, packagePath); err != nil {
+			return "", opts, fmt.Errorf("The sub-package needs the package to be in a module: %v", err)
+		}
+		if opts.importPath, err = packageImportPath(fsys, packagePath); err != nil {
+			return "", opts, err
+		}
+	}
+	if opts.Subdirs && opts.Verify {
+		return "", opts, fmt.Errorf("Verifying is not possible with subdirectories, since they are separate packages")
+	}
+	if opts.ChangedSince != "" {
+		if opts.changed, err = changedLines(packagePath, opts.ChangedSince); err != nil {
+			return "", opts, fmt.Errorf("Error reading changes since %s: %v", opts.ChangedSince, err)
+		}
+	}
+	if opts.RemoveOnly {
+		if opts.split, err = readSplitFunctions(fsys, packagePath, opts); err != nil {
+			return "", opts, fmt.Errorf("Error reading generated files: %v", err)
+		}
+	}
+
+	// Guard against rewriting the standard library by mistake
+	if goroot := runtime.GOROOT(); !opts.Force && goroot != "" && isUnderDir(packagePath, goroot) {
+		return "", opts, fmt.Errorf("Refusing to modify %s under GOROOT %s (use -force to override)", packagePath, goroot)
+	}
+	return packagePath, opts, nil
+}
+
+// moduleRelativePath returns the path of the package directory relative to the root of its module
+func moduleRelativePath(fsys FileSystem, packagePath string) (string, error) {
+	dir, root, err := moduleRoot(fsys, packagePath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Rel(root, dir)
+}
+
+// moduleRoot returns the absolute package directory and the root of its module
+// The module root is the closest directory containing go.mod, searched upwards from the package directory.
+func moduleRoot(fsys FileSystem, packagePath string) (string, string, error) {
+	dir, err := filepath.Abs(packagePath)
+	if err != nil {
+		return "", "", err
+	}
+	for root := dir; ; root = filepath.Dir(root) {
+		if _, err := fsys.Stat(filepath.Join(root, "go.mod")); err == nil {
+			return dir, root, nil
+		}
+		if filepath.Dir(root) == root {
+			return "", "", fmt.Errorf("No go.mod found above %s", packagePath)
+		}
+	}
+}
+
+// splitTarget returns the package directory of the path and, if the path is a .go file, the file itself
+// Paths that do not exist or are neither a directory nor a .go file are reported before anything is parsed.
+func splitTarget(fsys FileSystem, path string) (string, string, error) {
+	info, err := fsys.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", "", fmt.Errorf("No such package directory or .go file: %s", path)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("Error reading %s: %v", path, err)
+	}
+	if info.IsDir() {
+		return path, "", nil
+	}
+	if filepath.Ext(path) != ".go" {
+		return "", "", fmt.Errorf("Not a directory or a .go file: %s", path)
+	}
+	return filepath.Dir(path), filepath.Join(filepath.Dir(path), filepath.Base(path)), nil
+}
+
+// isUnderDir checks if the path is the directory or inside of it
+// Symbolic links are resolved when possible.
+func isUnderDir(path string, dir string) bool {
+	resolve := func(p string) string {
+		if abs, err := filepath.Abs(p); err == nil {
+			p = abs
+		}
+		if real, err := filepath.EvalSymlinks(p); err == nil {
+			p = real
+		}
+		return p
+	}
+	rel, err := filepath.Rel(resolve(dir), resolve(path))
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
 }
 
 // SingleFunctionFile represents a single function file
 type SingleFunctionFile struct {
 	// FileName is the name of the single function file
 	FileName string
+	// Source is the name of the original file of the function
+	Source string
+	// FuncName is the name of the function
+	// It is prefixed with the receiver type name for methods (e.g. "T.Method").
+	FuncName string
+	// Vars are the names of the package-level variables moved along with the function by Options.MoveExclusiveVars
+	Vars []string
 	// Package is the package declaration of the file
 	Package string
 	// Imports is the import declarations of the file
@@ -45,217 +661,1060 @@ type SingleFunctionFile struct {
 	Func string
 }
 
+// splitSuffix returns the suffix of generated file names, defaulting to fsplit
+func (opts Options) splitSuffix() string {
+	if opts.Suffix == "" {
+		return "fsplit"
+	}
+	return opts.Suffix
+}
+
+// logf logs the message if verbose logging is enabled
+func (opts Options) logf(format string, args ...any) {
+	if opts.Verbose {
+		log.Printf(format, args...)
+	}
+}
+
+// skipReason describes why a file is not a target of fsplit
+type skipReason string
+
+const (
+	skipTestFile      skipReason = "test file"
+	skipGeneratedFile skipReason = "generated file"
+	skipTooFewFuncs   skipReason = "too few functions"
+	skipTooManyFuncs  skipReason = "too many functions"
+	skipNotSelected   skipReason = "not the selected file"
+	skipCgoFile       skipReason = "cgo file"
+	skipMatchedGlob   skipReason = "matches a skip pattern"
+)
+
 // isNotTarget checks if the file matches one of the following criteria:
-// 1. It is a test file
-// 2. It is a generated file
-// 3. It contains less or equal to 1 function
-func isNotTarget(file *ast.File) bool {
+// 1. It is not the file fsplit was given, if any
+// 2. Its base name matches one of Options.Skip
+// 3. It is a test file and splitting of test files is not enabled
+// 4. It is a generated file
+// 5. It is a cgo file and Options.Force is not set
+// 6. It contains fewer functions than Options.MinFuncs (at least 2)
+// 7. It contains more functions than Options.MaxFuncs, if set
+// If the file is not a target, it also returns the reason
+func isNotTarget(fileName string, file *ast.File, opts Options) (bool, skipReason) {
+	// Check if the file is the one fsplit was given
+	if opts.onlyFile != "" && fileName != opts.onlyFile {
+		return true, skipNotSelected
+	}
+
+	// Check if the file is skipped explicitly
+	for _, pattern := range opts.Skip {
+		if ok, _ := filepath.Match(pattern, filepath.Base(fileName)); ok {
+			return true, skipMatchedGlob
+		}
+	}
+
 	// Check if the file is a test file by its name
-	if len(file.Name.Name) > 4 && file.Name.Name[len(file.Name.Name)-4:] == "_test" {
-		return true
+	if isTestFile(fileName) && !opts.IncludeTests {
+		return true, skipTestFile
 	}
 
 	// Check if the file is a generated file
 	for _, comment := range file.Comments {
 		if strings.Contains(comment.Text(), "Code generated") {
-			return true
+			return true, skipGeneratedFile
 		}
 	}
 
-	// Check if the file contains less or equal to 1 function
+	// Check if the file uses cgo, whose preamble and //export directives need care
+	if !opts.Force && slices.ContainsFunc(file.Imports, func(spec *ast.ImportSpec) bool { return spec.Path.Value == `"C"` }) {
+		return true, skipCgoFile
+	}
+
+	// Check if the number of functions is within the bounds
 	funcCount := 0
 	for _, decl := range file.Decls {
 		if _, ok := decl.(*ast.FuncDecl); ok {
 			funcCount++
 		}
 	}
-	return funcCount <= 1
+	if funcCount < max(opts.MinFuncs, 2) {
+		return true, skipTooFewFuncs
+	}
+	if opts.MaxFuncs > 0 && funcCount > opts.MaxFuncs {
+		return true, skipTooManyFuncs
+	}
+	return false, ""
 }
 
 // newFileName generates a new file name for the single function file
-func newFileName(original string, recv string, funcName string) string {
-	// Remove .go extension
-	stem := original[:len(original)-3]
-	if strings.HasSuffix(stem, ".fsplit.go") {
-		// get the original stem
-		split := strings.Split(original, ".")
-		stem = strings.Join(split[:len(split)-4], ".")
+// Functions from test files are written to files ending with _test.go so that they are still built as tests.
+// If order is positive, it is inserted as a zero-padded index after the stem (e.g. foo.0003._.Bar.fsplit.go).
+// splitSuffix replaces fsplit in the name, as in Options.Suffix.
+func newFileName(original string, order int, recv string, funcName string, splitSuffix string) string {
+	// Only the base name is rewritten, so that dots in directory names and drive letters are left alone
+	dir, base := filepath.Split(original)
+	stem, suffix := strings.TrimSuffix(base, ".go"), "."+splitSuffix+".go"
+	if isTestFile(base) {
+		stem, suffix = strings.TrimSuffix(base, "_test.go"), "."+splitSuffix+"_test.go"
+	}
+	if isSplitFileName(base, splitSuffix) {
+		// Name functions of a generated file after its original file instead of stacking the names
+		parts := strings.Split(strings.TrimSuffix(stem, "."+splitSuffix), ".")
+		if len(parts) > 2 {
+			parts = parts[:len(parts)-2]
+		}
+		stem = strings.Join(parts, ".")
+	}
+	if order > 0 {
+		stem += fmt.Sprintf(".%04d", order)
 	}
 	if recv == "" {
 		recv = "_"
 	}
-	return stem + "." + recv + "." + funcName + ".fsplit.go"
+	return filepath.Join(dir, stem+"."+recv+"."+funcName+suffix)
+}
+
+// packFileName returns the name of the n-th file of an original file packing several functions with Options.PackLines
+// It is the name of the file of its first function with the receiver and function parts replaced, like foo.pack1.fsplit.go,
+// so that prefixes such as the order or the path stay.
+func packFileName(fileName string, n int, splitSuffix string) string {
+	dir, base := filepath.Split(fileName)
+	suffix := "." + splitSuffix + ".go"
+	if isTestFile(base) {
+		suffix = "." + splitSuffix + "_test.go"
+	}
+	parts := strings.Split(strings.TrimSuffix(base, suffix), ".")
+	return filepath.Join(dir, strings.Join(parts[:len(parts)-2], ".")+fmt.Sprintf(".pack%d", n)+suffix)
+}
+
+// singleNameKey returns the key under which names of single function files must be unique
+// Names differing only by case only collide on case-insensitive file systems, which Options.CaseSafeNames opts into.
+func singleNameKey(fileName string, opts Options) string {
+	if opts.CaseSafeNames {
+		return strings.ToLower(fileName)
+	}
+	return fileName
+}
+
+// withCaseSuffix appends -n to the function part of a single function file name, as in foo._.bar-2.fsplit.go
+// Go identifiers cannot contain "-", so the function name can be recovered from the file name.
+func withCaseSuffix(fileName string, n int, splitSuffix string) string {
+	i := strings.LastIndex(fileName, "."+splitSuffix)
+	return fileName[:i] + fmt.Sprintf("-%d", n) + fileName[i:]
+}
+
+// packageClause returns the source up to the end of the line of the package clause and the blank lines after it
+// It includes the comments before the package clause and a trailing comment on its line,
+// but not the comments of the first declaration.
+// The blank lines are kept since gofmt does not add one between a commented package clause and the imports.
+// end is the offset of the end of the package name.
+func packageClause(src string, end int) string {
+	i := strings.IndexByte(src[end:], '\n')
+	if i < 0 {
+		return src + "\n"
+	}
+	end += i + 1
+	rest := src[end:]
+	blank := rest[:len(rest)-len(strings.TrimLeft(rest, " \t\r\n"))]
+	if j := strings.LastIndexByte(blank, '\n'); j >= 0 {
+		end += j + 1
+	}
+	return src[:end]
+}
+
+// groupFileName returns the name of the file grouping functions of the package of the file, like init.fsplit.go
+// Test files get their own file, and the external test package another one, so that each file has a single package.
+func groupFileName(fileName string, file *ast.File, stem string, splitSuffix string) string {
+	dir := filepath.Dir(fileName)
+	switch {
+	case !isTestFile(fileName):
+		return filepath.Join(dir, stem+"."+splitSuffix+".go")
+	case strings.HasSuffix(file.Name.Name, "_test"):
+		return filepath.Join(dir, stem+".xtest."+splitSuffix+"_test.go")
+	default:
+		return filepath.Join(dir, stem+"."+splitSuffix+"_test.go")
+	}
 }
 
+// unknownRecvTypeName is the receiver type name of methods whose receiver type has no name fsplit understands
+// It is not a valid identifier, so that it never conflates with a real type or with free functions ("_").
+const unknownRecvTypeName = "unknown-recv"
+
 // getRecvTypeName gets the receiver type name of the function if it exists
-// If the function does not have a receiver, it returns an empty string
+// If the function does not have a receiver, it returns an empty string.
+// If the receiver type cannot be unwrapped down to a name, as for ASTs from parse recovery, it returns unknownRecvTypeName.
+// Only the receiver type is looked at, so unnamed receivers like (*T) and names like fmt that shadow a package work alike.
 func getRecvTypeName(decl *ast.FuncDecl) string {
 	if decl.Recv == nil {
 		return ""
 	}
-	recv := decl.Recv.List[0]
-	switch recvType := recv.Type.(type) {
-	case *ast.StarExpr:
-		return recvType.X.(*ast.Ident).Name
-	case *ast.Ident:
-		return recvType.Name
+	if len(decl.Recv.List) == 0 {
+		return unknownRecvTypeName
+	}
+	// Unwrap pointers and type parameters of generic types (e.g. *Map[K, V]) down to the type name
+	expr := decl.Recv.List[0].Type
+	for {
+		switch recvType := expr.(type) {
+		case *ast.StarExpr:
+			expr = recvType.X
+		case *ast.ParenExpr:
+			expr = recvType.X
+		case *ast.IndexExpr:
+			expr = recvType.X
+		case *ast.IndexListExpr:
+			expr = recvType.X
+		case *ast.Ident:
+			return recvType.Name
+		default:
+			return unknownRecvTypeName
+		}
 	}
-	return ""
 }
 
 // extractFunctions extracts functions from the package and returns a list of SingleFunctionFile
-func extractFunctions(packagePath string) ([]SingleFunctionFile, error) {
+// It also counts the files that are not split by the reason, except those not selected by a single file argument.
+func extractFunctions(ctx context.Context, packagePath string, opts Options) ([]SingleFunctionFile, map[string]int, error) {
 	fset := token.NewFileSet()
-	pkgs, err := parser.ParseDir(fset, packagePath, nil, parser.ParseComments)
+	pkgs, err := parseDir(fset, opts.fileSystem(), packagePath, parser.ParseComments)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	var funcFiles []SingleFunctionFile
-	for _, pkg := range pkgs {
-		for _, file := range pkg.Files {
-			if isNotTarget(file) {
+	skipped := make(map[string]int)
+	// singleNames maps the names of single function files, as keyed by singleNameKey, to their function
+	singleNames := make(map[string]string)
+	for _, pkg := range sortedPackages(pkgs) {
+		var typeFiles map[string]string
+		if opts.ConstructorWithType {
+			typeFiles = findTypeFiles(pkg, opts)
+		}
+		var exclusive map[*ast.FuncDecl][]*ast.GenDecl
+		if opts.MoveExclusiveVars {
+			exclusive = exclusiveVars(pkg, nil, opts)
+		}
+		// Files are visited in name order so that grouped init functions and the logs keep a stable order
+		for _, fileName := range sortedFileNames(pkg) {
+			file := pkg.Files[fileName]
+			if err := ctx.Err(); err != nil {
+				return nil, nil, err
+			}
+			if skip, reason := isNotTarget(fileName, file, opts); skip {
+				opts.logf("skip %s: %s", fileName, reason)
+				if reason != skipNotSelected {
+					skipped[string(reason)]++
+				}
 				continue
 			}
+			opts.logf("split %s", fileName)
 
 			// init function can be declared multiple times
 			initCnt := 0
+			// funcIndex is the position of the function in the file, counting every function
+			funcIndex := 0
+			// pack is the file functions are packed into with PackLines, and packLines the lines it has so far
+			pack, packLines := "", 0
+			// packStart is the index in funcFiles of the first function of the pack, packed the number of its functions
+			// and packs the number of files of the original file packing several functions
+			packStart, packed, packs := 0, 0, 0
 
 			// Extract package declaration from the file.
 			// This is needed to copy comments before the package declaration.
-			var buf bytes.Buffer
-			err := printer.Fprint(&buf, fset, file)
+			// The original source is sliced because the offsets in fset refer to it.
+			// Reprinting the file would shift them for files that are not gofmt-ed or use CRLF line endings.
+			src, err := opts.fileSystem().ReadFile(fileName)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
-			fileContent := buf.String()
-			packageDecl := fileContent[:fset.Position(file.Decls[0].Pos()).Offset]
+			fileContent := string(src)
+			packageDecl := packageClause(fileContent, fset.Position(file.Name.End()).Offset)
 
+			kept := keptFunction(file, opts)
 			imports := ""
 			for _, decl := range file.Decls {
 				switch decl := decl.(type) {
 				case *ast.GenDecl:
 					if decl.Tok == token.IMPORT {
-						imports += fileContent[fset.Position(decl.Pos()).Offset:fset.Position(decl.End()).Offset] + "\n"
+						// Keep the doc comment, which is the cgo preamble for import "C",
+						// unless it is already part of the package declaration
+						start := fset.Position(decl.Pos()).Offset
+						if decl.Doc != nil && fset.Position(decl.Doc.Pos()).Offset >= len(packageDecl) {
+							start = fset.Position(decl.Doc.Pos()).Offset
+						}
+						imports += fileContent[start:fset.Position(decl.End()).Offset] + "\n"
 					}
 				case *ast.FuncDecl:
+					funcIndex++
+					if decl == kept {
+						continue
+					}
+					target, mapping := resolveMapping(fileName, decl, pkg, opts, nil)
+					if mapping == mappedToOwnFile || mapping == mappedToExistingFile {
+						continue
+					}
+					if mapping == notMapped && constructorType(decl, typeFiles, opts) != "" {
+						// Kept with its type by movedFunctions instead
+						continue
+					}
+					caughtAll := mapping == notMapped && isCaughtAll(fset, fileName, file, decl, opts)
+					if mapping == notMapped && !isExtracted(fset, fileName, decl, opts) && !caughtAll {
+						continue
+					}
 					var funcBuf bytes.Buffer
-					err := printer.Fprint(&funcBuf, fset, &printer.CommentedNode{Node: decl, Comments: file.Comments})
-					if err != nil {
-						return nil, err
+					if err := printVars(&funcBuf, fset, file, exclusive[decl]); err != nil {
+						return nil, nil, err
+					}
+					if err := printFunc(&funcBuf, fset, file, decl, opts); err != nil {
+						return nil, nil, err
 					}
 					recvTypeName := getRecvTypeName(decl)
+					if recvTypeName == unknownRecvTypeName {
+						opts.logf("unknown receiver type of %s in %s, naming it %s", decl.Name.Name, fileName, unknownRecvTypeName)
+					}
 					funcName := decl.Name.Name
 					if funcName == "init" {
 						initCnt++
 						funcName = fmt.Sprintf("init-%03d", initCnt)
 					}
-					newFileName := newFileName(fset.Position(file.Name.Pos()).Filename, recvTypeName, funcName)
+					order := 0
+					if opts.Order {
+						order = funcIndex
+					}
+					newFileName := newFileName(fset.Position(file.Name.Pos()).Filename, order, recvTypeName, funcName, opts.splitSuffix())
+					if opts.PathNames {
+						newFileName = withPath(newFileName, functionPath(decl, file))
+					}
+					if opts.Subdirs {
+						newFileName = filepath.Join(filepath.Dir(newFileName), cmp.Or(recvTypeName, "_"), filepath.Base(newFileName))
+					}
+					grouped := caughtAll
+					if caughtAll {
+						newFileName = groupFileName(fileName, file, opts.CatchAll, opts.splitSuffix())
+					}
+					if decl.Name.Name == "init" && decl.Recv == nil && opts.GroupInits && buildConstraint(file) == "" {
+						newFileName = groupFileName(fileName, file, "init", opts.splitSuffix())
+						grouped = true
+					}
+					if opts.QualifyNames {
+						newFileName = withPath(newFileName, file.Name.Name)
+					}
+					if mapping == mappedToNewFile {
+						newFileName = target
+						grouped = true
+					}
+					if opts.OutDir != "" {
+						name := filepath.Base(newFileName)
+						if opts.Subdirs {
+							// Keep the receiver subdirectory
+							name, _ = filepath.Rel(filepath.Dir(fileName), newFileName)
+						}
+						newFileName = filepath.Join(opts.OutDir, opts.outSubdir, name)
+					}
+					if !grouped {
+						// Single function files must never share a name, or one function would silently end up in the file of another
+						name := newFileName
+						for n := 2; singleNames[singleNameKey(newFileName, opts)] != ""; n++ {
+							if !opts.CaseSafeNames {
+								return nil, nil, fmt.Errorf("Error naming files: %s and %s would both be written to %s",
+									singleNames[singleNameKey(newFileName, opts)], qualifiedFuncName(decl), newFileName)
+							}
+							newFileName = withCaseSuffix(name, n, opts.splitSuffix())
+						}
+						singleNames[singleNameKey(newFileName, opts)] = qualifiedFuncName(decl)
+					}
+					if opts.PackLines > 0 && !grouped {
+						// Functions are separated by a blank line
+						lines := strings.Count(strings.TrimRight(funcBuf.String(), "\n"), "\n") + 1
+						if pack != "" && packLines+1+lines <= opts.PackLines {
+							if packed == 1 {
+								// A pack of several functions is not named after one of them
+								packs++
+								pack = packFileName(pack, packs, opts.splitSuffix())
+								funcFiles[packStart].FileName = pack
+							}
+							newFileName = pack
+							packLines += 1 + lines
+							packed++
+						} else {
+							pack, packLines = newFileName, lines
+							packStart, packed = len(funcFiles), 1
+						}
+					}
+					if vars := varNames(exclusive[decl]); len(vars) > 0 {
+						opts.logf("move %s with %s", strings.Join(vars, ", "), decl.Name.Name)
+					}
+					if kind := getTestFuncKind(fileName, decl); kind != testFuncNone {
+						opts.logf("extract %s (%s) from %s into %s", decl.Name.Name, kind, fileName, newFileName)
+					} else {
+						opts.logf("extract %s from %s into %s", decl.Name.Name, fileName, newFileName)
+					}
 					funcFiles = append(funcFiles, SingleFunctionFile{
 						FileName: newFileName,
+						Source:   fileName,
+						FuncName: qualifiedFuncName(decl),
+						Vars:     varNames(exclusive[decl]),
 						Package:  packageDecl,
 						Imports:  imports,
-						Func:     funcBuf.String(),
+						Func:     transformDoc(stripGenerateDirectives(funcBuf.String()), qualifiedFuncName(decl), fileName, opts.DocTransform),
 					})
 				}
 			}
 		}
 	}
 
-	return funcFiles, nil
+	return funcFiles, skipped, nil
 }
 
 // createSingleFunctionFiles creates single function files from the list of SingleFunctionFile
-func createSingleFunctionFiles(funcFiles []SingleFunctionFile) error {
+// Files are formatted and written concurrently by up to GOMAXPROCS workers,
+// and the first error encountered is returned.
+// It returns the names of the files that did not exist before.
+// On error, including cancellation of ctx, those files are removed again.
+func createSingleFunctionFiles(ctx context.Context, funcFiles []SingleFunctionFile, opts Options) ([]string, error) {
+	// Files grouping functions, such as the catch-all file, can come from several original files
+	sources := make(map[string][]string)
 	for _, funcFile := range funcFiles {
-		fileContent := funcFile.Package + funcFile.Imports + funcFile.Func
-		formatted, err := imports.Process(funcFile.FileName, []byte(fileContent), nil)
-		if err != nil {
-			return err
+		if source := filepath.Base(funcFile.Source); !slices.Contains(sources[funcFile.FileName], source) {
+			sources[funcFile.FileName] = append(sources[funcFile.FileName], source)
 		}
-		err = os.WriteFile(funcFile.FileName, formatted, 0644)
-		if err != nil {
-			return err
+	}
+	if opts.SortByName {
+		// mergeFunctionFiles keeps the order of funcFiles, which is the source order
+		funcFiles = slices.Clone(funcFiles)
+		slices.SortStableFunc(funcFiles, func(a, b SingleFunctionFile) int {
+			return strings.Compare(a.FuncName, b.FuncName)
+		})
+	}
+	funcFiles, err := mergeFunctionFiles(funcFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	fsys := opts.fileSystem()
+	// The names of the packages decide which imports are used
+	names := make(map[string]*packageNames)
+	for _, funcFile := range funcFiles {
+		dir := filepath.Dir(funcFile.Source)
+		if _, ok := names[dir]; !ok {
+			if names[dir], err = scanPackageNames(fsys, dir); err != nil {
+				return nil, err
+			}
 		}
 	}
-	return nil
+	progress := newProgress(len(funcFiles), opts)
+	written := make([]bool, len(funcFiles))
+	isNew := make([]bool, len(funcFiles))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(runtime.GOMAXPROCS(0))
+	for i, funcFile := range funcFiles {
+		g.Go(func() error {
+			if err := gctx.Err(); err != nil {
+				return err
+			}
+			header := opts.Header
+			if isSplitFileName(funcFile.FileName, opts.splitSuffix()) {
+				header += generatedHeader(sources[funcFile.FileName])
+			}
+			fileContent := header + funcFile.Package + funcFile.Imports + funcFile.Func
+			formatted, err := processImports(funcFile.FileName, []byte(fileContent), names[filepath.Dir(funcFile.Source)], opts)
+			if err != nil {
+				return err
+			}
+			if opts.NoNewImports {
+				if added, err := addedImports(funcFile.Imports, formatted); err != nil {
+					return err
+				} else if len(added) > 0 {
+					return fmt.Errorf("Error creating %s: goimports added imports its original files do not have: %s", funcFile.FileName, strings.Join(added, ", "))
+				}
+			}
+			if lines := bytes.Count(formatted, []byte("\n")); opts.MaxFileLines > 0 && lines > opts.MaxFileLines {
+				return fmt.Errorf("Error creating %s: %d lines exceed the limit of %d", funcFile.FileName, lines, opts.MaxFileLines)
+			}
+			_, err = fsys.Stat(funcFile.FileName)
+			isNew[i] = errors.Is(err, os.ErrNotExist)
+			// Generated files get the same permissions as their original file
+			if written[i], err = writeFileIfChanged(fsys, funcFile.FileName, formatted, fileMode(fsys, funcFile.Source)); err != nil {
+				return err
+			}
+			progress.step(funcFile.FileName)
+			return nil
+		})
+	}
+
+	var newFiles []string
+	err = g.Wait()
+	for i, funcFile := range funcFiles {
+		if written[i] && isNew[i] {
+			newFiles = append(newFiles, funcFile.FileName)
+		}
+	}
+	if err != nil {
+		removeFiles(fsys, newFiles)
+		return nil, err
+	}
+
+	// Log in the order of funcFiles to keep the output deterministic
+	for i, funcFile := range funcFiles {
+		if written[i] {
+			opts.logf("write %s", funcFile.FileName)
+		} else {
+			opts.logf("unchanged %s", funcFile.FileName)
+		}
+	}
+	return newFiles, nil
 }
 
-// isCommentAssociatedWithFunction checks if the comment is associated with any function
-func isCommentAssociatedWithFunction(comment *ast.CommentGroup, file *ast.File) bool {
-	for _, decl := range file.Decls {
-		if funcDecl, ok := decl.(*ast.FuncDecl); ok {
-			// Check if the comment is the function's doc comment
-			if funcDecl.Doc == comment {
-				return true
-			}
+// generatedHeader returns the comment marking a single function file as generated from the original files
+// It follows the convention of https://go.dev/s/generatedcode, so re-runs of fsplit skip the file as well.
+// Files named through Options.FileMapping without the split suffix, like ctor.go, do not get it, since they are maintained by hand.
+func generatedHeader(sources []string) string {
+	return fmt.Sprintf("// Code generated by fsplit from %s; DO NOT EDIT.\n\n", strings.Join(sources, ", "))
+}
 
-			// Check if the comment is inside the function
-			if funcDecl.Pos() < comment.Pos() && comment.Pos() < funcDecl.End() {
-				return true
-			}
+// removeFiles removes the files, ignoring errors
+// It is used to clean up after a failed run.
+func removeFiles(fsys FileSystem, names []string) {
+	for _, name := range names {
+		fsys.Remove(name)
+	}
+}
+
+// writeFileIfChanged writes the data to the file unless the file already has exactly the same content
+// Skipping the write keeps the modification time, so re-runs do not cause spurious rebuilds.
+// It returns whether the file was written.
+func writeFileIfChanged(fsys FileSystem, name string, data []byte, perm os.FileMode) (bool, error) {
+	existing, err := fsys.ReadFile(name)
+	if err == nil && bytes.Equal(existing, data) {
+		return false, nil
+	}
+	return true, fsys.WriteFile(name, data, perm)
+}
+
+// fileMode returns the permissions of the file, or 0644 if they cannot be determined
+func fileMode(fsys FileSystem, name string) os.FileMode {
+	info, err := fsys.Stat(name)
+	if err != nil {
+		return 0644
+	}
+	return info.Mode().Perm()
+}
+
+// isCommentAssociatedWithFunction checks if the comment is associated with any of the functions
+// Standalone comments between functions are not associated with either of them and stay in the original file.
+// The same holds for comments after the last declaration, such as a closing note, even if the last function is removed,
+// unless they are on the line of its closing brace (see trailingComment) or are linter directives (see followingComment).
+func isCommentAssociatedWithFunction(comment *ast.CommentGroup, funcs []*ast.FuncDecl) bool {
+	for _, funcDecl := range funcs {
+		// Check if the comment is the function's doc comment
+		if funcDecl.Doc == comment {
+			return true
+		}
+
+		// Check if the comment is inside the function
+		if funcDecl.Pos() < comment.Pos() && comment.Pos() < funcDecl.End() {
+			return true
 		}
 	}
 
 	return false
 }
 
+// isGenerateDirective checks if the comment is a //go:generate directive
+// Other //go: directives (e.g. //go:noinline) apply to the function they precede
+// and must travel with it instead of staying in the original file.
+func isGenerateDirective(comment *ast.Comment) bool {
+	return strings.HasPrefix(comment.Text, "//go:generate")
+}
+
+// generateDirectives returns a comment group containing only the //go:generate directives
+// of the function's doc comment, or nil if there is none
+func generateDirectives(comment *ast.CommentGroup, funcs []*ast.FuncDecl) *ast.CommentGroup {
+	var directives []*ast.Comment
+	for _, funcDecl := range funcs {
+		if funcDecl.Doc == comment {
+			for _, c := range comment.List {
+				if isGenerateDirective(c) {
+					directives = append(directives, c)
+				}
+			}
+		}
+	}
+	if len(directives) == 0 {
+		return nil
+	}
+	return &ast.CommentGroup{List: directives}
+}
+
+// stripGenerateDirectives removes //go:generate directives from the doc comment of a printed function
+// The directives are kept in the original file, so copying them would make go generate run them twice.
+func stripGenerateDirectives(funcSrc string) string {
+	lines := strings.Split(funcSrc, "\n")
+	var kept []string
+	for i, line := range lines {
+		if strings.HasPrefix(line, "func") {
+			kept = append(kept, lines[i:]...)
+			break
+		}
+		if !strings.HasPrefix(line, "//go:generate") {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
 // removeUnnecessaryComments removes unnecessary comments from the file
-// Unnecessary comments are comments that are associated with any function
-func removeUnnecessaryComments(file *ast.File) {
+// Unnecessary comments are comments that are associated with any of the removed functions,
+// comments following a removed function on the line of its closing brace or right below it,
+// and detached doc comments of removed functions, as far as Options.CommentAssociation moves them.
+// //go:generate directives in doc comments are kept because go generate runs them regardless of their position.
+func removeUnnecessaryComments(fset *token.FileSet, file *ast.File, removed []*ast.FuncDecl, opts Options) {
+	trailing := make(map[*ast.Comment]bool)
+	detached := make(map[*ast.CommentGroup]bool)
+	for _, funcDecl := range removed {
+		if c := trailingComment(fset, file, funcDecl, opts); c != nil {
+			trailing[c] = true
+		}
+		if doc := detachedDoc(fset, file, funcDecl, opts); doc != nil {
+			detached[doc] = true
+		}
+		if comment := followingComment(fset, file, funcDecl, opts); comment != nil {
+			detached[comment] = true
+		}
+	}
+
 	var comments []*ast.CommentGroup
 	for _, comment := range file.Comments {
-		if !isCommentAssociatedWithFunction(comment, file) {
+		if detached[comment] {
+			continue
+		}
+		if isCommentAssociatedWithFunction(comment, removed) {
+			if directives := generateDirectives(comment, removed); directives != nil {
+				comments = append(comments, directives)
+			}
+			continue
+		}
+		var kept []*ast.Comment
+		for _, c := range comment.List {
+			if !trailing[c] {
+				kept = append(kept, c)
+			}
+		}
+		if len(kept) == len(comment.List) {
 			comments = append(comments, comment)
+		} else if len(kept) > 0 {
+			comments = append(comments, &ast.CommentGroup{List: kept})
 		}
 	}
 	file.Comments = comments
 }
 
-// removeFunctionsFromFile removes functions from the file
+// trailingComment returns the comment following the closing brace of the function on the same line, or nil
+// Such a comment, like a //nolint directive, belongs to the function and moves with it unless CommentsStrict is used.
+func trailingComment(fset *token.FileSet, file *ast.File, decl *ast.FuncDecl, opts Options) *ast.Comment {
+	if opts.CommentAssociation == CommentsStrict {
+		return nil
+	}
+	line := fset.Position(decl.End()).Line
+	for _, comment := range file.Comments {
+		for _, c := range comment.List {
+			if c.Pos() >= decl.End() && fset.Position(c.Pos()).Line == line {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// detachedDoc returns the comment separated from the function by blank lines, if it is treated as its doc comment
+// With Options.DetachedDocLines set, this is the last comment group before a function without a doc comment
+// if at most that many blank lines separate them, no declaration is in between, it starts on a line of its own,
+// and it contains no //go: directive. Otherwise, and always for the package doc comment, it returns nil.
+func detachedDoc(fset *token.FileSet, file *ast.File, decl *ast.FuncDecl, opts Options) *ast.CommentGroup {
+	if opts.DetachedDocLines <= 0 || decl.Doc != nil || opts.CommentAssociation == CommentsStrict {
+		return nil
+	}
+	prevEnd := file.Name.End()
+	for _, d := range file.Decls {
+		if d.End() < decl.Pos() && d.End() > prevEnd {
+			prevEnd = d.End()
+		}
+	}
+	var doc *ast.CommentGroup
+	for _, comment := range file.Comments {
+		if comment.Pos() > prevEnd && comment.End() < decl.Pos() {
+			doc = comment
+		}
+	}
+	if doc == nil || fset.Position(doc.Pos()).Line == fset.Position(prevEnd).Line {
+		return nil
+	}
+	if blank := fset.Position(decl.Pos()).Line - fset.Position(doc.End()).Line - 1; blank > opts.DetachedDocLines {
+		return nil
+	}
+	for _, c := range doc.List {
+		if strings.HasPrefix(c.Text, "//go:") {
+			return nil
+		}
+	}
+	return doc
+}
+
+// printFunc prints the function with its comments as it is written to another file
+// The detached doc comment, if any, is kept above the function with a blank line,
+// a comment on the line of the closing brace stays there, and the following comment, if any, stays below it.
+func printFunc(buf *bytes.Buffer, fset *token.FileSet, file *ast.File, decl *ast.FuncDecl, opts Options) error {
+	if doc := detachedDoc(fset, file, decl, opts); doc != nil {
+		for _, c := range doc.List {
+			buf.WriteString(c.Text + "\n")
+		}
+		buf.WriteString("\n")
+	}
+	if err := printer.Fprint(buf, fset, &printer.CommentedNode{Node: decl, Comments: file.Comments}); err != nil {
+		return err
+	}
+	if c := trailingComment(fset, file, decl, opts); c != nil {
+		buf.WriteString(" " + c.Text)
+	}
+	if comment := followingComment(fset, file, decl, opts); comment != nil {
+		for _, c := range comment.List {
+			buf.WriteString("\n" + c.Text)
+		}
+	}
+	return nil
+}
+
+// followingComment returns the comment right after the function that moves with it, or nil
+// This is the comment group starting on the line after the closing brace, unless it is the doc comment of the next declaration
+// or contains a //go: directive. CommentsLoose moves any such comment, and CommentsAdjacent one made only of
+// linter directives like //revive:enable, which close a directive in the doc comment of the function.
+// A comment after the last declaration of the file, such as an "end of file" note, is a footer of the file
+// and is not moved by CommentsLoose either, unless it is made only of linter directives.
+func followingComment(fset *token.FileSet, file *ast.File, decl *ast.FuncDecl, opts Options) *ast.CommentGroup {
+	if opts.CommentAssociation == CommentsStrict {
+		return nil
+	}
+	line := fset.Position(decl.End()).Line
+	for _, comment := range file.Comments {
+		if fset.Position(comment.Pos()).Line != line+1 {
+			continue
+		}
+		for _, d := range file.Decls {
+			if d, ok := d.(*ast.FuncDecl); ok && d.Doc == comment {
+				return nil
+			}
+			if d, ok := d.(*ast.GenDecl); ok && d.Doc == comment {
+				return nil
+			}
+		}
+		directives := true
+		for _, c := range comment.List {
+			if strings.HasPrefix(c.Text, "//go:") {
+				return nil
+			}
+			directives = directives && isDirective(c.Text)
+		}
+		if (opts.CommentAssociation != CommentsLoose || isFooter(file, comment)) && !directives {
+			return nil
+		}
+		return comment
+	}
+	return nil
+}
+
+// isFooter checks if the comment follows the last declaration of the file
+func isFooter(file *ast.File, comment *ast.CommentGroup) bool {
+	return len(file.Decls) > 0 && comment.Pos() > file.Decls[len(file.Decls)-1].End()
+}
+
+// directivePattern matches directive comments like //nolint:errcheck, //lint:ignore or //revive:disable
+var directivePattern = regexp.MustCompile(`^//[a-z0-9]+:[a-z0-9]`)
+
+// isDirective checks if the comment is a directive in the //word: form
+func isDirective(comment string) bool {
+	return directivePattern.MatchString(comment)
+}
+
+// removedFunctions returns the functions to be removed from the file
+func removedFunctions(fset *token.FileSet, fileName string, file *ast.File, pkg *ast.Package, opts Options, created map[string]bool, moved map[*ast.FuncDecl]bool) []*ast.FuncDecl {
+	if opts.RemoveOnly {
+		if isSplitFileName(fileName, opts.splitSuffix()) {
+			return nil
+		}
+		return removedSplitFunctions(fileName, file, opts.split)
+	}
+
+	var typeFiles map[string]string
+	if opts.ConstructorWithType {
+		typeFiles = findTypeFiles(pkg, opts)
+	}
+	kept := keptFunction(file, opts)
+	var removed []*ast.FuncDecl
+	for _, decl := range file.Decls {
+		funcDecl, ok := decl.(*ast.FuncDecl)
+		if !ok || funcDecl == kept {
+			continue
+		}
+		_, mapping := resolveMapping(fileName, funcDecl, pkg, opts, created)
+		// Constructors kept with their type are only removed when moved
+		extracted := constructorType(funcDecl, typeFiles, opts) == "" &&
+			(isExtracted(fset, fileName, funcDecl, opts) || isCaughtAll(fset, fileName, file, funcDecl, opts))
+		if mapping == mappedToNewFile || (mapping == notMapped && extracted) || moved[funcDecl] {
+			removed = append(removed, funcDecl)
+		}
+	}
+	return removed
+}
+
+// removeFunctionsFromFile removes the functions from the file
 // This should be called after removeUnnecessaryComments
-func removeFunctionsFromFile(file *ast.File) {
+func removeFunctionsFromFile(file *ast.File, removed []*ast.FuncDecl) {
 	var decls []ast.Decl
 	for _, decl := range file.Decls {
-		if _, ok := decl.(*ast.FuncDecl); !ok {
+		if funcDecl, ok := decl.(*ast.FuncDecl); !ok || !slices.Contains(removed, funcDecl) {
 			decls = append(decls, decl)
 		}
 	}
 	file.Decls = decls
 }
 
+// CommentAssociation decides which comments around a function move with it
+type CommentAssociation string
+
+const (
+	// CommentsStrict moves only the doc comment and the comments inside of the function
+	CommentsStrict CommentAssociation = "strict"
+	// CommentsAdjacent also moves a comment on the line of the closing brace, directives like //revive:enable
+	// on the line after it, and with Options.DetachedDocLines a comment separated from the function by blank lines
+	CommentsAdjacent CommentAssociation = "adjacent"
+	// CommentsLoose also moves the comments starting right on the line after the closing brace,
+	// unless they are the doc comment of the next declaration
+	CommentsLoose CommentAssociation = "loose"
+)
+
+// isValid checks if the mode is known
+// The empty mode is the same as CommentsAdjacent.
+func (c CommentAssociation) isValid() bool {
+	switch c {
+	case "", CommentsStrict, CommentsAdjacent, CommentsLoose:
+		return true
+	}
+	return false
+}
+
+// RemoveEmpty decides what happens to original files that have nothing left after splitting
+type RemoveEmpty string
+
+const (
+	// RemoveEmptyNever rewrites empty original files in place, keeping them as stubs with only the package clause
+	RemoveEmptyNever RemoveEmpty = "never"
+	// RemoveEmptyOnly deletes original files that became empty and rewrites the others in place
+	RemoveEmptyOnly RemoveEmpty = "only"
+)
+
+// isValid checks if the mode is known
+// The empty mode is the same as RemoveEmptyNever.
+func (r RemoveEmpty) isValid() bool {
+	switch r {
+	case "", RemoveEmptyNever, RemoveEmptyOnly:
+		return true
+	}
+	return false
+}
+
+// isEmptyFile checks if the source has nothing but the package clause
+// Build constraints do not count, but any other comment, including the package doc comment, does.
+func isEmptyFile(src []byte) bool {
+	file, err := parser.ParseFile(token.NewFileSet(), "", src, parser.ParseComments)
+	if err != nil || len(file.Decls) > 0 {
+		return false
+	}
+	for _, comment := range file.Comments {
+		for _, c := range comment.List {
+			if !strings.HasPrefix(c.Text, "//go:build") && !strings.HasPrefix(c.Text, "// +build") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// rewrite is a prepared change to an original file
+type rewrite struct {
+	// fileName is the name of the original file
+	fileName string
+	// newName is the name the file is written to
+	// If it differs from fileName, the original file is removed.
+	newName string
+	// content is the new content of the file
+	content []byte
+	// delete is true if the file is deleted instead
+	delete bool
+}
+
+// remainingFileName returns the name of the original file after splitting
+// With a suffix, foo.go becomes foo.<suffix>.go and foo_test.go becomes foo.<suffix>_test.go.
+// Files that already have the suffix keep their name.
+func remainingFileName(fileName string, suffix string) string {
+	if suffix == "" {
+		return fileName
+	}
+	stem, ext := strings.TrimSuffix(fileName, ".go"), ".go"
+	if isTestFile(fileName) {
+		stem, ext = strings.TrimSuffix(fileName, "_test.go"), "_test.go"
+	}
+	if strings.HasSuffix(stem, "."+suffix) {
+		return fileName
+	}
+	return stem + "." + suffix + ext
+}
+
 // removeFunctions removes functions from the package
-func removeFunctions(packagePath string) error {
+// The rewritten, renamed and deleted files are recorded in the result.
+// Functions moved by the layout or the file mapping are appended to their destination file.
+// created is the set of files created by createSingleFunctionFiles.
+// All rewrites are prepared before any file is written, and ctx is only checked while preparing,
+// so the package is never left with only some of the originals rewritten.
+func removeFunctions(ctx context.Context, packagePath string, opts Options, created map[string]bool, result *Result) error {
 	fset := token.NewFileSet()
-	pkgs, err := parser.ParseDir(fset, packagePath, nil, parser.ParseComments)
+	pkgs, err := parseDir(fset, opts.fileSystem(), packagePath, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+
+	fsys := opts.fileSystem()
+	names, err := scanPackageNames(fsys, packagePath)
 	if err != nil {
 		return err
 	}
+	var rewrites []rewrite
+	for _, pkg := range sortedPackages(pkgs) {
+		var moves map[string][]movedFunction
+		if !opts.RemoveOnly {
+			moves = movedFunctions(fset, pkg, opts, created)
+		}
+		moved := make(map[*ast.FuncDecl]bool)
+		for _, funcs := range moves {
+			for _, f := range funcs {
+				moved[f.decl] = true
+			}
+		}
+		var exclusive map[*ast.FuncDecl][]*ast.GenDecl
+		if opts.MoveExclusiveVars {
+			exclusive = exclusiveVars(pkg, created, opts)
+		}
 
-	for _, pkg := range pkgs {
-		for fileName, file := range pkg.Files {
-			if isNotTarget(file) {
+		// Files are visited in name order so that the logs and the result keep a stable order
+		for _, fileName := range sortedFileNames(pkg) {
+			file := pkg.Files[fileName]
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			skip, _ := isNotTarget(fileName, file, opts)
+			incoming := moves[fileName]
+			if skip && len(incoming) == 0 {
 				continue
 			}
 
-			removeUnnecessaryComments(file)
-			removeFunctionsFromFile(file)
+			if !skip {
+				removed := removedFunctions(fset, fileName, file, pkg, opts, created, moved)
+				removeUnnecessaryComments(fset, file, removed, opts)
+				removeFunctionsFromFile(file, removed)
+				// Only extracted functions take their variables along, not those moved to another original file
+				var vars []*ast.GenDecl
+				for _, funcDecl := range removed {
+					if !moved[funcDecl] {
+						vars = append(vars, exclusive[funcDecl]...)
+					}
+				}
+				removeVarsFromFile(fset, file, vars)
+			}
+			for _, f := range incoming {
+				addImports(fset, file, f.file)
+			}
 
 			var buf bytes.Buffer
 			err := printer.Fprint(&buf, fset, file)
 			if err != nil {
 				return err
 			}
+			for _, f := range incoming {
+				buf.WriteString("\n")
+				if err := printFunc(&buf, fset, f.file, f.decl, opts); err != nil {
+					return err
+				}
+				buf.WriteString("\n")
+			}
 
 			// Remove unused imports
-			formatted, err := imports.Process(fileName, buf.Bytes(), nil)
-
-			err = os.WriteFile(fileName, formatted, 0644)
+			formatted, err := formatSource(fileName, buf.Bytes(), names, opts)
+			if err != nil {
+				return err
+			}
+			// The file was reprinted, so its line endings are taken from the file itself
+			original, err := fsys.ReadFile(fileName)
 			if err != nil {
 				return err
 			}
+			formatted = keepLineEndings(original, formatted)
+
+			newName := fileName
+			if !skip {
+				newName = remainingFileName(fileName, opts.RemainingSuffix)
+			}
+			rewrites = append(rewrites, rewrite{
+				fileName: fileName,
+				newName:  newName,
+				content:  formatted,
+				delete:   opts.RemoveEmpty == RemoveEmptyOnly && isEmptyFile(formatted),
+			})
+		}
+	}
+
+	progress := newProgress(len(rewrites), opts)
+	for _, r := range rewrites {
+		if err := applyRewrite(fsys, r, opts, result); err != nil {
+			return err
+		}
+		progress.step(r.newName)
+	}
+	return nil
+}
+
+// applyRewrite writes, renames or deletes the original file as prepared and records it in the result
+// Files whose content does not change are left alone and not recorded.
+func applyRewrite(fsys FileSystem, r rewrite, opts Options, result *Result) error {
+	if r.delete {
+		if err := fsys.Remove(r.fileName); err != nil {
+			return err
 		}
+		opts.logf("delete %s", r.fileName)
+		result.Deleted = append(result.Deleted, r.fileName)
+		return nil
 	}
 
+	if r.newName == r.fileName {
+		// Files with nothing removed, e.g. because every function was filtered out, keep their modification time
+		written, err := writeFileIfChanged(fsys, r.fileName, r.content, fileMode(fsys, r.fileName))
+		if err != nil {
+			return err
+		}
+		if !written {
+			opts.logf("unchanged %s", r.fileName)
+			return nil
+		}
+		result.Rewritten = append(result.Rewritten, r.fileName)
+		opts.logf("rewrite %s", r.fileName)
+		return nil
+	}
+	if err := fsys.WriteFile(r.newName, r.content, fileMode(fsys, r.fileName)); err != nil {
+		return err
+	}
+	result.Rewritten = append(result.Rewritten, r.newName)
+	if err := fsys.Remove(r.fileName); err != nil {
+		return err
+	}
+	opts.logf("rename %s to %s", r.fileName, r.newName)
+	if result.Renamed == nil {
+		result.Renamed = make(map[string]string)
+	}
+	result.Renamed[r.fileName] = r.newName
 	return nil
 }
@@ -0,0 +1,795 @@
+package fsplit
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writePackage writes the files, keyed by their name relative to a new temporary directory, and returns the directory
+func writePackage(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		fileName := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fileName, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// readPackage returns the contents of the files in the directory, keyed by their name relative to it
+func readPackage(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = string(content)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// runFsplit splits the package in the directory with the options and returns the files of the directory afterwards
+// Configuration files outside of the directory are ignored.
+func runFsplit(t *testing.T, dir string, opts Options) (*Result, map[string]string) {
+	t.Helper()
+	opts.NoConfigFile = true
+	result, err := RunFsplitWithOptions(dir, opts)
+	if err != nil {
+		t.Fatalf("RunFsplitWithOptions: %v", err)
+	}
+	return result, readPackage(t, dir)
+}
+
+// fileNames returns the sorted names of the files
+func fileNames(files map[string]string) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestPackageClauseTrailingComment(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "without imports",
+			src: `package a // import "example.com/a"
+
+func A() {}
+
+func B() {}
+`,
+			want: `package a // import "example.com/a"
+`,
+		},
+		{
+			name: "with imports becoming unused",
+			src: `package a // the package a
+
+import "fmt"
+
+func A() { fmt.Println() }
+
+func B() {}
+`,
+			want: `package a // the package a
+`,
+		},
+		{
+			name: "with remaining declarations",
+			src: `package a // the package a
+
+import "fmt"
+
+type T struct{}
+
+func A() { fmt.Println() }
+
+func B() {}
+`,
+			want: `package a // the package a
+
+type T struct{}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writePackage(t, map[string]string{"a.go": tt.src})
+			_, files := runFsplit(t, dir, Options{})
+			if got := files["a.go"]; got != tt.want {
+				t.Errorf("stripped a.go =\n%s\nwant\n%s", got, tt.want)
+			}
+			for _, name := range []string{"a._.A.fsplit.go", "a._.B.fsplit.go"} {
+				if !slices.Contains(strings.Split(files[name], "\n"), strings.SplitN(tt.want, "\n", 2)[0]) {
+					t.Errorf("%s does not keep the package clause comment:\n%s", name, files[name])
+				}
+			}
+		})
+	}
+}
+
+func TestPackageClauseTrailingCommentBeforeImports(t *testing.T) {
+	dir := writePackage(t, map[string]string{"a.go": `package a // the package a
+
+import (
+	"fmt"
+)
+
+func A() { fmt.Println() }
+
+func B() {}
+`})
+	_, files := runFsplit(t, dir, Options{})
+	want := `// Code generated by fsplit from a.go; DO NOT EDIT.
+
+package a // the package a
+
+import (
+	"fmt"
+)
+
+func A() { fmt.Println() }
+`
+	if got := files["a._.A.fsplit.go"]; got != want {
+		t.Errorf("a._.A.fsplit.go =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSplitSingleFile(t *testing.T) {
+	src := `// Package shapes computes areas
+package shapes
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Circle is a circle
+type Circle struct {
+	R float64
+}
+
+// NewCircle returns a circle with the radius
+func NewCircle(r float64) (*Circle, error) {
+	if r < 0 {
+		return nil, errors.New("negative radius")
+	}
+	return &Circle{R: r}, nil
+}
+
+// Area returns the area of the circle
+func (c *Circle) Area() float64 {
+	return math.Pi * square(c.R)
+}
+
+func (c Circle) String() string {
+	return fmt.Sprintf("circle(%g)", c.R)
+}
+
+func square(x float64) float64 { return x * x }
+`
+	dir := writePackage(t, map[string]string{"shapes.go": src})
+	result, files := runFsplit(t, dir, Options{})
+
+	want := map[string]string{
+		"shapes.go": `// Package shapes computes areas
+package shapes
+
+// Circle is a circle
+type Circle struct {
+	R float64
+}
+`,
+		"shapes._.NewCircle.fsplit.go": `// Code generated by fsplit from shapes.go; DO NOT EDIT.
+
+// Package shapes computes areas
+package shapes
+
+import (
+	"errors"
+)
+
+// NewCircle returns a circle with the radius
+func NewCircle(r float64) (*Circle, error) {
+	if r < 0 {
+		return nil, errors.New("negative radius")
+	}
+	return &Circle{R: r}, nil
+}
+`,
+		"shapes.Circle.Area.fsplit.go": `// Code generated by fsplit from shapes.go; DO NOT EDIT.
+
+// Package shapes computes areas
+package shapes
+
+import (
+	"math"
+)
+
+// Area returns the area of the circle
+func (c *Circle) Area() float64 {
+	return math.Pi * square(c.R)
+}
+`,
+		"shapes.Circle.String.fsplit.go": `// Code generated by fsplit from shapes.go; DO NOT EDIT.
+
+// Package shapes computes areas
+package shapes
+
+import (
+	"fmt"
+)
+
+func (c Circle) String() string {
+	return fmt.Sprintf("circle(%g)", c.R)
+}
+`,
+		"shapes._.square.fsplit.go": `// Code generated by fsplit from shapes.go; DO NOT EDIT.
+
+// Package shapes computes areas
+package shapes
+
+func square(x float64) float64 { return x * x }
+`,
+	}
+	if !slices.Equal(fileNames(files), fileNames(want)) {
+		t.Fatalf("files = %v, want %v", fileNames(files), fileNames(want))
+	}
+	for name, content := range want {
+		if files[name] != content {
+			t.Errorf("%s =\n%s\nwant\n%s", name, files[name], content)
+		}
+	}
+	if !slices.Equal(result.Rewritten, []string{filepath.Join(dir, "shapes.go")}) || len(result.Deleted) > 0 {
+		t.Errorf("rewritten %v and deleted %v, want only shapes.go rewritten", result.Rewritten, result.Deleted)
+	}
+	if got := result.CreatedFiles(); got != 4 {
+		t.Errorf("CreatedFiles() = %d, want 4", got)
+	}
+}
+
+func TestSplitSingleFileRemoveEmpty(t *testing.T) {
+	dir := writePackage(t, map[string]string{"a.go": `package a
+
+import "strings"
+
+func Upper(s string) string { return strings.ToUpper(s) }
+
+func Lower(s string) string { return strings.ToLower(s) }
+`})
+	result, files := runFsplit(t, dir, Options{RemoveEmpty: RemoveEmptyOnly})
+	if want := []string{"a._.Lower.fsplit.go", "a._.Upper.fsplit.go"}; !slices.Equal(fileNames(files), want) {
+		t.Fatalf("files = %v, want %v", fileNames(files), want)
+	}
+	if !slices.Equal(result.Deleted, []string{filepath.Join(dir, "a.go")}) {
+		t.Errorf("deleted %v, want a.go", result.Deleted)
+	}
+}
+
+// parseFunc parses the source of a file and returns its first function
+func parseFunc(t *testing.T, src string) *ast.FuncDecl {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), "a.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, decl := range file.Decls {
+		if funcDecl, ok := decl.(*ast.FuncDecl); ok {
+			return funcDecl
+		}
+	}
+	t.Fatal("no function in source")
+	return nil
+}
+
+func TestGetRecvTypeName(t *testing.T) {
+	tests := []struct {
+		recv string
+		want string
+	}{
+		{"", ""},
+		{"(f Foo)", "Foo"},
+		{"(f *Foo)", "Foo"},
+		{"(Foo)", "Foo"},
+		{"(*Foo)", "Foo"},
+		{"(_ Foo)", "Foo"},
+		{"(_ *Foo)", "Foo"},
+		{"(f (Foo))", "Foo"},
+		{"(f *(Foo))", "Foo"},
+		{"(fmt *Foo)", "Foo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.recv, func(t *testing.T) {
+			decl := parseFunc(t, "package a\n\nfunc "+tt.recv+" M() {}\n")
+			if got := getRecvTypeName(decl); got != tt.want {
+				t.Errorf("getRecvTypeName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetRecvTypeNameGeneric(t *testing.T) {
+	tests := []struct {
+		recv string
+		want string
+	}{
+		{"(l List[T])", "List"},
+		{"(l *List[T])", "List"},
+		{"(l List[_])", "List"},
+		{"(l *List[_])", "List"},
+		{"(m Map[K, V])", "Map"},
+		{"(m *Map[K, V])", "Map"},
+		{"(m Map[_, V])", "Map"},
+		{"(m *Map[K, _])", "Map"},
+		{"(m *(Map[K, V]))", "Map"},
+		{"(List[T])", "List"},
+		{"(*Map[K, V])", "Map"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.recv, func(t *testing.T) {
+			decl := parseFunc(t, "package a\n\nfunc "+tt.recv+" M() {}\n")
+			if got := getRecvTypeName(decl); got != tt.want {
+				t.Errorf("getRecvTypeName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPathHelpers(t *testing.T) {
+	// The helpers only rewrite the base name, so the same names come out whether
+	// the backslashes separate directories, as on Windows, or are part of the name
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"newFileName", newFileName(`C:\work\pkg.v2\a.go`, 0, "", "F", "fsplit"), `C:\work\pkg.v2\a._.F.fsplit.go`},
+		{"newFileName method", newFileName(`C:\work\pkg.v2\a.go`, 0, "T", "M", "fsplit"), `C:\work\pkg.v2\a.T.M.fsplit.go`},
+		{"newFileName test", newFileName(`C:\work\pkg.v2\a_test.go`, 0, "", "TestF", "fsplit"), `C:\work\pkg.v2\a._.TestF.fsplit_test.go`},
+		{"newFileName order", newFileName(`C:\work\pkg.v2\a.go`, 3, "", "F", "fsplit"), `C:\work\pkg.v2\a.0003._.F.fsplit.go`},
+		{"newFileName resplit", newFileName(`C:\work\pkg.v2\a._.F.fsplit.go`, 0, "", "G", "fsplit"), `C:\work\pkg.v2\a._.G.fsplit.go`},
+		{"newFileName slashes", newFileName("/work/pkg.v2/a.go", 0, "", "F", "fsplit"), "/work/pkg.v2/a._.F.fsplit.go"},
+		{"packFileName", packFileName(`C:\work\pkg.v2\a._.F.fsplit.go`, 1, "fsplit"), `C:\work\pkg.v2\a.pack1.fsplit.go`},
+		{"packFileName slashes", packFileName("/work/pkg.v2/a._.F.fsplit.go", 2, "fsplit"), "/work/pkg.v2/a.pack2.fsplit.go"},
+		{"unsplitFileName", unsplitFileName(`C:\work\pkg.v2\a_test.go`, "fsplit"), `C:\work\pkg.v2\a.unsplit.fsplit_test.go`},
+		{"remainingFileName", remainingFileName(`C:\work\pkg.v2\a.go`, "rest"), `C:\work\pkg.v2\a.rest.go`},
+		{"remainingFileName kept", remainingFileName(`C:\work\pkg.v2\a.rest.go`, "rest"), `C:\work\pkg.v2\a.rest.go`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %q, want %q", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBadReceiverFileName(t *testing.T) {
+	// Parse recovery leaves a *ast.BadExpr for a receiver type it cannot read
+	decl := &ast.FuncDecl{
+		Recv: &ast.FieldList{List: []*ast.Field{{Type: &ast.BadExpr{}}}},
+		Name: ast.NewIdent("M"),
+	}
+	recv := getRecvTypeName(decl)
+	if recv != unknownRecvTypeName {
+		t.Fatalf("getRecvTypeName() = %q, want %q", recv, unknownRecvTypeName)
+	}
+	if got, want := newFileName("a.go", 0, recv, decl.Name.Name, "fsplit"), "a.unknown-recv.M.fsplit.go"; got != want {
+		t.Errorf("newFileName() = %q, want %q", got, want)
+	}
+}
+
+func TestReceiverFileNames(t *testing.T) {
+	for _, recv := range []string{"(f Foo)", "(f *Foo)", "(Foo)", "(*Foo)"} {
+		t.Run(recv, func(t *testing.T) {
+			dir := writePackage(t, map[string]string{"a.go": "package a\n\ntype Foo struct{}\n\nfunc " + recv + " M() {}\n\nfunc F() {}\n"})
+			_, files := runFsplit(t, dir, Options{})
+			want := []string{"a.Foo.M.fsplit.go", "a._.F.fsplit.go", "a.go"}
+			if !slices.Equal(fileNames(files), want) {
+				t.Fatalf("files = %v, want %v", fileNames(files), want)
+			}
+			if !strings.Contains(files["a.Foo.M.fsplit.go"], "func "+recv+" M() {}") {
+				t.Errorf("a.Foo.M.fsplit.go does not keep the receiver:\n%s", files["a.Foo.M.fsplit.go"])
+			}
+		})
+	}
+}
+
+func TestGenericReceiverFileNames(t *testing.T) {
+	dir := writePackage(t, map[string]string{"a.go": `package a
+
+type List[T any] []T
+
+type Map[K comparable, V any] map[K]V
+
+func (l List[T]) Len() int { return len(l) }
+
+func (l *List[T]) Push(v T) { *l = append(*l, v) }
+
+func (m Map[K, V]) Len() int { return len(m) }
+
+func (m *Map[K, V]) Set(k K, v V) { (*m)[k] = v }
+`})
+	_, files := runFsplit(t, dir, Options{})
+	want := []string{"a.List.Len.fsplit.go", "a.List.Push.fsplit.go", "a.Map.Len.fsplit.go", "a.Map.Set.fsplit.go", "a.go"}
+	if !slices.Equal(fileNames(files), want) {
+		t.Fatalf("files = %v, want %v", fileNames(files), want)
+	}
+	if !strings.Contains(files["a.Map.Set.fsplit.go"], "func (m *Map[K, V]) Set(k K, v V) { (*m)[k] = v }") {
+		t.Errorf("a.Map.Set.fsplit.go does not keep the type parameters of the receiver:\n%s", files["a.Map.Set.fsplit.go"])
+	}
+}
+
+func TestCommentAfterLastDeclaration(t *testing.T) {
+	footers := []struct {
+		name   string
+		footer string
+	}{
+		{"right below", "}\n// end of file\n"},
+		{"after a blank line", "}\n\n// end of file\n"},
+		{"block comment", "}\n/*\nend of file\n*/\n"},
+	}
+	for _, footer := range footers {
+		for _, mode := range []CommentAssociation{CommentsStrict, CommentsAdjacent, CommentsLoose} {
+			t.Run(footer.name+"/"+string(mode), func(t *testing.T) {
+				src := "package a\n\ntype T int\n\nfunc A() {}\n\nfunc B() {\n" + footer.footer
+				dir := writePackage(t, map[string]string{"a.go": src})
+				_, files := runFsplit(t, dir, Options{CommentAssociation: mode})
+				comment := strings.TrimPrefix(footer.footer, "}\n")
+				if !strings.HasSuffix(files["a.go"], "type T int\n\n"+strings.TrimLeft(comment, "\n")) {
+					t.Errorf("a.go does not keep the comment after the last declaration:\n%s", files["a.go"])
+				}
+				if strings.Contains(files["a._.B.fsplit.go"], "end of file") {
+					t.Errorf("a._.B.fsplit.go took the comment after the last declaration:\n%s", files["a._.B.fsplit.go"])
+				}
+			})
+		}
+	}
+}
+
+func TestDirectiveAfterLastDeclaration(t *testing.T) {
+	dir := writePackage(t, map[string]string{"a.go": `package a
+
+type T int
+
+func A() {}
+
+//revive:disable:exported
+func B() {
+}
+//revive:enable:exported
+`})
+	_, files := runFsplit(t, dir, Options{CommentAssociation: CommentsLoose})
+	if !strings.HasSuffix(files["a._.B.fsplit.go"], "}\n\n//revive:enable:exported\n") {
+		t.Errorf("a._.B.fsplit.go does not close its directive:\n%s", files["a._.B.fsplit.go"])
+	}
+	if want := "package a\n\ntype T int\n"; files["a.go"] != want {
+		t.Errorf("a.go =\n%s\nwant\n%s", files["a.go"], want)
+	}
+}
+
+func TestLinterDirectives(t *testing.T) {
+	dir := writePackage(t, map[string]string{"a.go": `package a
+
+//lint:ignore U1000 kept for later
+func A() {}
+
+//revive:disable:exported
+func B() {
+}
+//revive:enable:exported
+
+//nolint:unused
+func C() {}
+`})
+	_, files := runFsplit(t, dir, Options{})
+	want := map[string]string{
+		"a._.A.fsplit.go": "//lint:ignore U1000 kept for later\nfunc A() {}\n",
+		"a._.B.fsplit.go": "//revive:disable:exported\nfunc B() {\n}\n\n//revive:enable:exported\n",
+		"a._.C.fsplit.go": "//nolint:unused\nfunc C() {}\n",
+	}
+	for name, decl := range want {
+		if !strings.HasSuffix(files[name], "package a\n\n"+decl) {
+			t.Errorf("%s =\n%s\nwant it to end with\n%s", name, files[name], decl)
+		}
+	}
+	if files["a.go"] != "package a\n" {
+		t.Errorf("a.go kept a directive:\n%s", files["a.go"])
+	}
+}
+
+func TestClosingBraceComment(t *testing.T) {
+	dir := writePackage(t, map[string]string{"a.go": `package a
+
+func A() {
+	_ = 1
+} //nolint:all
+
+func B() {} //nolint:unused
+
+var x = 1
+`})
+	_, files := runFsplit(t, dir, Options{})
+	if !strings.HasSuffix(files["a._.A.fsplit.go"], "func A() {\n\t_ = 1\n} //nolint:all\n") {
+		t.Errorf("a._.A.fsplit.go does not keep the comment of A:\n%s", files["a._.A.fsplit.go"])
+	}
+	if !strings.HasSuffix(files["a._.B.fsplit.go"], "func B() {} //nolint:unused\n") {
+		t.Errorf("a._.B.fsplit.go does not keep the comment of B:\n%s", files["a._.B.fsplit.go"])
+	}
+	if want := "package a\n\nvar x = 1\n"; files["a.go"] != want {
+		t.Errorf("a.go =\n%s\nwant\n%s", files["a.go"], want)
+	}
+}
+
+func TestNamesDifferingByCase(t *testing.T) {
+	src := `package a
+
+type T struct{}
+
+func New() *T { return new(T) }
+
+func new() *T { return nil }
+`
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{"default", Options{}, []string{"a._.New.fsplit.go", "a._.new.fsplit.go", "a.go"}},
+		{"case-safe", Options{CaseSafeNames: true}, []string{"a._.New.fsplit.go", "a._.new-2.fsplit.go", "a.go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writePackage(t, map[string]string{"a.go": src})
+			_, files := runFsplit(t, dir, tt.opts)
+			if !slices.Equal(fileNames(files), tt.want) {
+				t.Errorf("files = %v, want %v", fileNames(files), tt.want)
+			}
+		})
+	}
+}
+
+func TestCRLF(t *testing.T) {
+	src := "package a\r\n\r\nimport \"fmt\"\r\n\r\n// A prints a\r\nfunc A() {\r\n\tfmt.Println(`a\r\nb`)\r\n}\r\n\r\nconst limit = 1\r\n\r\nfunc B() int { return limit }\r\n"
+	dir := writePackage(t, map[string]string{"a.go": src})
+	_, files := runFsplit(t, dir, Options{Verify: true})
+
+	want := map[string]string{
+		"a.go":            "package a\r\n\r\nconst limit = 1\r\n",
+		"a._.A.fsplit.go": "// Code generated by fsplit from a.go; DO NOT EDIT.\r\n\r\npackage a\r\n\r\nimport \"fmt\"\r\n\r\n// A prints a\r\nfunc A() {\r\n\tfmt.Println(`a\r\nb`)\r\n}\r\n",
+		"a._.B.fsplit.go": "// Code generated by fsplit from a.go; DO NOT EDIT.\r\n\r\npackage a\r\n\r\nfunc B() int { return limit }\r\n",
+	}
+	if !slices.Equal(fileNames(files), fileNames(want)) {
+		t.Fatalf("files = %v, want %v", fileNames(files), fileNames(want))
+	}
+	for name, content := range want {
+		if files[name] != content {
+			t.Errorf("%s = %q, want %q", name, files[name], content)
+		}
+	}
+}
+
+// readOnlyFileSystem is the file system of the operating system refusing every change
+type readOnlyFileSystem struct {
+	osFileSystem
+}
+
+func (readOnlyFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return errors.New("read-only file system")
+}
+
+func (readOnlyFileSystem) Remove(name string) error {
+	return errors.New("read-only file system")
+}
+
+func TestRefuseGOROOT(t *testing.T) {
+	dir := filepath.Join(runtime.GOROOT(), "src", "strings")
+	if _, err := os.Stat(dir); err != nil {
+		t.Skipf("GOROOT has no sources: %v", err)
+	}
+	_, err := RunFsplitWithOptions(dir, Options{FileSystem: readOnlyFileSystem{}, NoConfigFile: true})
+	if err == nil || !strings.Contains(err.Error(), "Refusing to modify") || !strings.Contains(err.Error(), "use -force") {
+		t.Errorf("err = %v, want a refusal to modify GOROOT", err)
+	}
+}
+
+func TestFuncCountBounds(t *testing.T) {
+	// fN.go has N functions
+	files := make(map[string]string)
+	for n := 1; n <= 4; n++ {
+		src := "package p\n"
+		for i := range n {
+			src += fmt.Sprintf("\nfunc F%d%d() {}\n", n, i)
+		}
+		files[fmt.Sprintf("f%d.go", n)] = src
+	}
+	tests := []struct {
+		name    string
+		opts    Options
+		split   []string
+		skipped map[string]int
+	}{
+		{"default", Options{}, []string{"f2.go", "f3.go", "f4.go"}, map[string]int{"too few functions": 1}},
+		{"min 3", Options{MinFuncs: 3}, []string{"f3.go", "f4.go"}, map[string]int{"too few functions": 2}},
+		{"max 3", Options{MaxFuncs: 3}, []string{"f2.go", "f3.go"}, map[string]int{"too few functions": 1, "too many functions": 1}},
+		{"min and max 3", Options{MinFuncs: 3, MaxFuncs: 3}, []string{"f3.go"}, map[string]int{"too few functions": 2, "too many functions": 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writePackage(t, files)
+			result, _ := runFsplit(t, dir, tt.opts)
+			var split []string
+			for _, file := range result.Files {
+				split = append(split, filepath.Base(file.Source))
+			}
+			slices.Sort(split)
+			if !slices.Equal(split, tt.split) {
+				t.Errorf("split %v, want %v", split, tt.split)
+			}
+			if !maps.Equal(result.SkippedFiles, tt.skipped) {
+				t.Errorf("SkippedFiles = %v, want %v", result.SkippedFiles, tt.skipped)
+			}
+		})
+	}
+}
+
+func TestModuleRelative(t *testing.T) {
+	root := writePackage(t, map[string]string{
+		"go.mod":         "module example.com/m\n\ngo 1.22\n",
+		"a.go":           "package m\n\nfunc A() {}\n\nfunc B() {}\n",
+		"sub/inner/c.go": "package inner\n\nfunc C() {}\n\nfunc D() {}\n",
+	})
+	// The module root is found above the nested package, whose path below it is mirrored in the output directory
+	out := t.TempDir()
+	if _, err := RunFsplitWithOptions(filepath.Join(root, "sub", "inner"), Options{OutDir: out, ModuleRelative: true, NoConfigFile: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fileNames(readPackage(t, out)), []string{"sub/inner/c._.C.fsplit.go", "sub/inner/c._.D.fsplit.go"}; !slices.Equal(got, want) {
+		t.Errorf("output files = %v, want %v", got, want)
+	}
+	if got, want := fileNames(readPackage(t, root)), []string{"a.go", "go.mod", "sub/inner/c.go"}; !slices.Equal(got, want) {
+		t.Errorf("module files = %v, want them untouched in %v", got, want)
+	}
+}
+
+func TestMaxFileLines(t *testing.T) {
+	files := map[string]string{"a.go": "package p\n\nfunc A() {}\n\nfunc Long() {\n\t_ = 1\n\t_ = 2\n}\n"}
+	dir := writePackage(t, files)
+	// a._.Long.fsplit.go has 8 lines
+	_, err := RunFsplitWithOptions(dir, Options{MaxFileLines: 7, NoConfigFile: true})
+	if want := "a._.Long.fsplit.go: 8 lines exceed the limit of 7"; err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("err = %v, want it to contain %q", err, want)
+	}
+	if got := readPackage(t, dir); !maps.Equal(got, files) {
+		t.Errorf("files after the failed split = %v, want %v", got, files)
+	}
+	runFsplit(t, dir, Options{MaxFileLines: 8})
+}
+
+func TestMissingPath(t *testing.T) {
+	dir := writePackage(t, map[string]string{"a.go": "package a\n\nfunc A() {}\n\nfunc B() {}\n"})
+	for _, path := range []string{filepath.Join(dir, "missing"), filepath.Join(dir, "missing.go")} {
+		_, err := RunFsplitWithOptions(path, Options{NoConfigFile: true})
+		if want := "No such package directory or .go file: " + path; err == nil || err.Error() != want {
+			t.Errorf("err = %v, want %q", err, want)
+		}
+	}
+}
+
+func TestFileMode(t *testing.T) {
+	dir := writePackage(t, map[string]string{"a.go": "package a\n\nconst x = 1\n\nfunc A() {}\n\nfunc B() {}\n"})
+	if err := os.Chmod(filepath.Join(dir, "a.go"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, files := runFsplit(t, dir, Options{})
+	if want := []string{"a._.A.fsplit.go", "a._.B.fsplit.go", "a.go"}; !slices.Equal(fileNames(files), want) {
+		t.Fatalf("files = %v, want %v", fileNames(files), want)
+	}
+	for _, name := range fileNames(files) {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("%s has mode %v, want %v", name, info.Mode().Perm(), os.FileMode(0600))
+		}
+	}
+}
+
+// countingFileSystem is the file system of the operating system recording the files written to
+type countingFileSystem struct {
+	osFileSystem
+	written []string
+}
+
+func (fsys *countingFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	fsys.written = append(fsys.written, name)
+	return fsys.osFileSystem.WriteFile(name, data, perm)
+}
+
+func TestRerunWritesNothing(t *testing.T) {
+	src := "package a\n\nfunc A() {}\n\nfunc B() {}\n"
+	t.Run("out", func(t *testing.T) {
+		dir := writePackage(t, map[string]string{"a.go": src})
+		out := t.TempDir()
+		runFsplit(t, dir, Options{OutDir: out})
+		fsys := &countingFileSystem{}
+		runFsplit(t, dir, Options{OutDir: out, FileSystem: fsys})
+		if len(fsys.written) > 0 {
+			t.Errorf("the re-run wrote %v", fsys.written)
+		}
+	})
+	t.Run("restored original", func(t *testing.T) {
+		dir := writePackage(t, map[string]string{"a.go": src})
+		runFsplit(t, dir, Options{})
+		// The original comes back, as after a checkout, while the generated files are still there
+		if err := os.WriteFile(filepath.Join(dir, "a.go"), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		fsys := &countingFileSystem{}
+		_, files := runFsplit(t, dir, Options{FileSystem: fsys})
+		if want := []string{filepath.Join(dir, "a.go")}; !slices.Equal(fsys.written, want) {
+			t.Errorf("the re-run wrote %v, want only %v", fsys.written, want)
+		}
+		if files["a.go"] != "package a\n" {
+			t.Errorf("a.go =\n%s\nwant the functions removed", files["a.go"])
+		}
+	})
+}
+
+func TestCgoExport(t *testing.T) {
+	files := map[string]string{"a.go": "package p\n\n// #include <stdlib.h>\nimport \"C\"\n\nimport \"fmt\"\n\n//export Exported\nfunc Exported() C.int { return 2 }\n\nfunc Plain() { fmt.Println() }\n"}
+	dir := writePackage(t, files)
+	result, got := runFsplit(t, dir, Options{})
+	if result.SkippedFiles["cgo file"] != 1 || !maps.Equal(got, files) {
+		t.Fatalf("cgo file was not skipped without Force: skipped %v, files %v", result.SkippedFiles, got)
+	}
+
+	_, got = runFsplit(t, dir, Options{Force: true})
+	// The preamble is carried into every file, and the //export directive stays with its function
+	want := "package p\n\n// #include <stdlib.h>\nimport \"C\"\n\n//export Exported\nfunc Exported() C.int { return 2 }\n"
+	if !strings.HasSuffix(got["a._.Exported.fsplit.go"], want) {
+		t.Errorf("a._.Exported.fsplit.go =\n%s\nwant it to end with\n%s", got["a._.Exported.fsplit.go"], want)
+	}
+	if !strings.Contains(got["a._.Plain.fsplit.go"], "// #include <stdlib.h>\nimport \"C\"\n") {
+		t.Errorf("a._.Plain.fsplit.go does not keep the preamble:\n%s", got["a._.Plain.fsplit.go"])
+	}
+	if strings.Contains(got["a.go"], "//export") {
+		t.Errorf("a.go kept the //export directive:\n%s", got["a.go"])
+	}
+}
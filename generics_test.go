@@ -0,0 +1,173 @@
+package fsplit
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// typeCheck type-checks the package in the directory, leaving out its test files
+func typeCheck(t *testing.T, dir string) error {
+	t.Helper()
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 1 {
+		t.Fatalf("%s has %d packages, want 1", dir, len(pkgs))
+	}
+	var files []*ast.File
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			files = append(files, file)
+		}
+	}
+	conf := types.Config{Importer: importer.Default()}
+	_, err = conf.Check(filepath.Base(dir), fset, files, nil)
+	return err
+}
+
+func TestGenericFunctions(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"a.go": `package p
+
+import (
+	"cmp"
+	c "cmp"
+	"fmt"
+	"io"
+)
+
+// Number is a constraint declared in the package
+type Number interface {
+	~int | ~float64
+}
+
+func Map[T, U any](s []T, f func(T) U) []U {
+	var r []U
+	for _, v := range s {
+		r = append(r, f(v))
+	}
+	return r
+}
+
+func Max[T cmp.Ordered](a, b T) T {
+	return max(a, b)
+}
+
+func Sum[T Number, S ~[]T](s S) T {
+	var sum T
+	for _, v := range s {
+		sum += v
+	}
+	return sum
+}
+
+func Show[T interface{ fmt.Stringer | ~string }](v T) {}
+
+func Ord[T c.Ordered](v T) {}
+
+func Write[W io.Writer](w W) {}
+
+type List[T any] struct{ items []T }
+
+func (l *List[T]) Push(v T) {
+	l.items = append(l.items, v)
+}
+`,
+		// The package name of the import differs from the one goimports would assume
+		"b.go": `package p
+
+import "example.com/bar"
+
+func Ordered[T num.Ordered](v T) {}
+
+func Other() {}
+`,
+	})
+	_, files := runFsplit(t, dir, Options{Verify: true})
+
+	tests := []struct {
+		file      string
+		signature string
+		imports   []string
+	}{
+		{"a._.Map.fsplit.go", "func Map[T, U any](s []T, f func(T) U) []U {", nil},
+		{"a._.Max.fsplit.go", "func Max[T cmp.Ordered](a, b T) T {", []string{`"cmp"`}},
+		{"a._.Sum.fsplit.go", "func Sum[T Number, S ~[]T](s S) T {", nil},
+		{"a._.Show.fsplit.go", "func Show[T interface{ fmt.Stringer | ~string }](v T) {}", []string{`"fmt"`}},
+		{"a._.Ord.fsplit.go", "func Ord[T c.Ordered](v T) {}", []string{`c "cmp"`}},
+		{"a._.Write.fsplit.go", "func Write[W io.Writer](w W) {}", []string{`"io"`}},
+		{"a.List.Push.fsplit.go", "func (l *List[T]) Push(v T) {", nil},
+		{"b._.Ordered.fsplit.go", "func Ordered[T num.Ordered](v T) {}", []string{`"example.com/bar"`}},
+	}
+	for _, tt := range tests {
+		src, ok := files[tt.file]
+		if !ok {
+			t.Errorf("%s was not created", tt.file)
+			continue
+		}
+		if !strings.Contains(src, tt.signature) {
+			t.Errorf("%s lacks the signature %q:\n%s", tt.file, tt.signature, src)
+		}
+		for _, imp := range tt.imports {
+			if !strings.Contains(src, imp) {
+				t.Errorf("%s lacks the import %s used by the constraint:\n%s", tt.file, imp, src)
+			}
+		}
+		if tt.imports == nil && strings.Contains(src, "import") {
+			t.Errorf("%s has imports it does not use:\n%s", tt.file, src)
+		}
+	}
+	if src := files["a.go"]; !strings.Contains(src, "type Number interface") || strings.Contains(src, "func ") {
+		t.Errorf("a.go should keep only the types:\n%s", src)
+	}
+}
+
+func TestGenericReceiverTypeCheck(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"a.go": `package p
+
+type Map[K comparable, V any] map[K]V
+
+func (m *Map[K, V]) Get(k K) V { return (*m)[k] }
+
+func (m *Map[K, V]) Set(k K, v V) { (*m)[k] = v }
+
+func Keys[K comparable, V any](m Map[K, V]) []K {
+	var keys []K
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+`,
+	})
+	_, files := runFsplit(t, dir, Options{})
+	if src := files["a.Map.Get.fsplit.go"]; !strings.Contains(src, "func (m *Map[K, V]) Get(k K) V {") {
+		t.Errorf("a.Map.Get.fsplit.go does not keep [K, V] on the receiver:\n%s", src)
+	}
+	if err := typeCheck(t, dir); err != nil {
+		t.Errorf("the split package does not compile: %v", err)
+	}
+
+	// A split that lost a declaration is rejected
+	if err := os.Remove(filepath.Join(dir, "a.Map.Set.fsplit.go")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "b.go"), []byte("package p\n\nfunc set(m Map[int, int]) { m.Set(1, 2) }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := typeCheck(t, dir); err == nil || !strings.Contains(err.Error(), "m.Set undefined") {
+		t.Errorf("err = %v, want m.Set undefined", err)
+	}
+}
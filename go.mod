@@ -4,9 +4,8 @@ go 1.22.0
 
 toolchain go1.22.9
 
-require golang.org/x/tools v0.27.0
-
 require (
-	golang.org/x/mod v0.22.0 // indirect
-	golang.org/x/sync v0.9.0 // indirect
+	golang.org/x/mod v0.22.0
+	golang.org/x/sync v0.9.0
+	golang.org/x/tools v0.27.0
 )
@@ -0,0 +1,97 @@
+package fsplit
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// generateDirective is the directive added by Options.GoGenerate to re-run fsplit on the package
+const generateDirective = "//go:generate fsplit ."
+
+// hasGenerateDirective checks if the file already has a //go:generate directive running fsplit
+func hasGenerateDirective(file *ast.File) bool {
+	for _, comment := range file.Comments {
+		for _, c := range comment.List {
+			if strings.HasPrefix(c.Text, "//go:generate fsplit") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// generateDirectiveFile returns the file of the package to add the directive to
+// It is Options.GoGenerateFile if set, otherwise the file with the package doc comment,
+// or the first original file in lexical order.
+func generateDirectiveFile(packagePath string, pkg *ast.Package, opts Options) (string, error) {
+	if opts.GoGenerateFile != "" {
+		fileName := filepath.Join(packagePath, opts.GoGenerateFile)
+		if pkg.Files[fileName] == nil {
+			return "", fmt.Errorf("File %s is not part of package %s", fileName, pkg.Name)
+		}
+		return fileName, nil
+	}
+
+	var candidates []string
+	for fileName, file := range pkg.Files {
+		if isTestFile(fileName) || ast.IsGenerated(file) {
+			continue
+		}
+		if file.Doc != nil {
+			return fileName, nil
+		}
+		candidates = append(candidates, fileName)
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("No file of package %s is left to hold the directive", pkg.Name)
+	}
+	return slices.Min(candidates), nil
+}
+
+// addGenerateDirective adds a //go:generate directive re-running fsplit to the package after the package clause
+// Nothing is done if a file of the package already has one, so repeated runs do not add it twice.
+// The rewritten file is recorded in the result.
+func addGenerateDirective(packagePath string, opts Options, result *Result) error {
+	fsys := opts.fileSystem()
+	fset := token.NewFileSet()
+	pkgs, err := parseDir(fset, fsys, packagePath, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+
+	for _, pkg := range pkgs {
+		if strings.HasSuffix(pkg.Name, "_test") {
+			continue
+		}
+		found := false
+		for _, file := range pkg.Files {
+			found = found || hasGenerateDirective(file)
+		}
+		if found {
+			continue
+		}
+		fileName, err := generateDirectiveFile(packagePath, pkg, opts)
+		if err != nil {
+			return err
+		}
+		src, err := fsys.ReadFile(fileName)
+		if err != nil {
+			return err
+		}
+		clause := packageClause(string(src), fset.Position(pkg.Files[fileName].Name.End()).Offset)
+		content := clause + "\n" + generateDirective + "\n" + string(src[len(clause):])
+		if err := fsys.WriteFile(fileName, []byte(content), fileMode(fsys, fileName)); err != nil {
+			return err
+		}
+		opts.logf("add go:generate directive to %s", fileName)
+		if !slices.Contains(result.Rewritten, fileName) {
+			result.Rewritten = append(result.Rewritten, fileName)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package fsplit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateDirectiveNotDuplicated(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"a.go": "// Package p does things\npackage p\n\nfunc A() {}\n\nfunc B() {}\n",
+		"b.go": "package p\n\nfunc C() {}\n\nfunc D() {}\n",
+	})
+	runFsplit(t, dir, Options{GoGenerate: true})
+	// The second run finds the directive of the first and adds no other
+	_, files := runFsplit(t, dir, Options{GoGenerate: true})
+
+	count := 0
+	for name, content := range files {
+		n := strings.Count(content, generateDirective)
+		if n > 0 && name != "a.go" {
+			t.Errorf("%s has the directive, want it in a.go with the package doc", name)
+		}
+		count += n
+	}
+	if count != 1 {
+		t.Errorf("the package has %d directives, want 1", count)
+	}
+}
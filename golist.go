@@ -0,0 +1,43 @@
+package fsplit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// goListDirs returns the directories of the packages with the import paths as resolved by go list in the current directory
+// It is a variable so that tests can stub the go command out.
+var goListDirs = func(ctx context.Context, importPaths []string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, "go", append([]string{"list", "-f", "{{.Dir}}"}, importPaths...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// RunFsplitImportPaths runs the fsplit tool with the given options on the packages with the import paths,
+// such as those printed by go list ./...
+// It returns the results of all packages merged into one.
+func RunFsplitImportPaths(importPaths []string, opts Options) (*Result, error) {
+	return RunFsplitImportPathsContext(context.Background(), importPaths, opts)
+}
+
+// RunFsplitImportPathsContext runs the fsplit tool with the given options on the packages with the import paths
+// The import paths are resolved to directories by go list in the current directory,
+// and the packages are split one after another like by RunFsplitRecursiveContext.
+func RunFsplitImportPathsContext(ctx context.Context, importPaths []string, opts Options) (*Result, error) {
+	if len(importPaths) == 0 {
+		return &Result{}, nil
+	}
+	dirs, err := goListDirs(ctx, importPaths)
+	if err != nil {
+		return nil, fmt.Errorf("Error resolving packages: %v", err)
+	}
+	return splitPackages(ctx, dirs, opts)
+}
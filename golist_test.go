@@ -0,0 +1,34 @@
+package fsplit
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestRunFsplitImportPaths(t *testing.T) {
+	root := writePackage(t, map[string]string{
+		"a/a.go": "package a\n\nfunc A() {}\n\nfunc B() {}\n",
+		"b/b.go": "package b\n\nfunc C() {}\n\nfunc D() {}\n",
+	})
+	goListDirsOrig := goListDirs
+	t.Cleanup(func() { goListDirs = goListDirsOrig })
+	var listed []string
+	goListDirs = func(ctx context.Context, importPaths []string) ([]string, error) {
+		listed = importPaths
+		return []string{filepath.Join(root, "a"), filepath.Join(root, "b")}, nil
+	}
+
+	importPaths := []string{"example.com/m/a", "example.com/m/b"}
+	if _, err := RunFsplitImportPaths(importPaths, Options{NoConfigFile: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(listed, importPaths) {
+		t.Errorf("go list got %v, want %v", listed, importPaths)
+	}
+	want := []string{"a/a._.A.fsplit.go", "a/a._.B.fsplit.go", "a/a.go", "b/b._.C.fsplit.go", "b/b._.D.fsplit.go", "b/b.go"}
+	if got := fileNames(readPackage(t, root)); !slices.Equal(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,125 @@
+package fsplit
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoreRule is a pattern of a .gitignore file
+type ignoreRule struct {
+	// dir is the directory of the .gitignore file, which the pattern is relative to
+	dir string
+	// pattern matches slash-separated paths relative to dir
+	pattern *regexp.Regexp
+	// negate re-includes paths matched by an earlier pattern
+	negate bool
+	// dirOnly matches only directories
+	dirOnly bool
+}
+
+// ignoreRules are the patterns of every .gitignore file from the walked root down to a directory
+// Later rules take precedence, as in git.
+type ignoreRules []ignoreRule
+
+// isIgnored checks if the path is ignored by the rules
+func (rules ignoreRules) isIgnored(path string, isDir bool) bool {
+	ignored := false
+	for _, rule := range rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		rel, err := filepath.Rel(rule.dir, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		if rule.pattern.MatchString(filepath.ToSlash(rel)) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// readIgnoreRules appends the patterns of the .gitignore file in the directory, if any, to the rules
+// The rules are copied so that sibling directories do not share the appended patterns.
+func readIgnoreRules(fsys FileSystem, dir string, rules ignoreRules) (ignoreRules, error) {
+	data, err := fsys.ReadFile(filepath.Join(dir, ".gitignore"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return rules, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rules = append(ignoreRules(nil), rules...)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{dir: dir}
+		if rule.negate = strings.HasPrefix(line, "!"); rule.negate {
+			line = line[1:]
+		}
+		if rule.dirOnly = strings.HasSuffix(line, "/"); rule.dirOnly {
+			line = strings.TrimSuffix(line, "/")
+		}
+		if rule.pattern, err = ignorePattern(line); err != nil {
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// ignorePattern converts a .gitignore pattern to a regular expression
+// Patterns containing a slash are relative to the .gitignore file, and other patterns match at any depth.
+// "*", "?", "[...]" and "**" have their gitignore meaning.
+func ignorePattern(pattern string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	if strings.Contains(pattern, "/") {
+		pattern = strings.TrimPrefix(pattern, "/")
+	} else {
+		sb.WriteString("(.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			sb.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			sb.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	// A matched directory ignores everything inside of it
+	sb.WriteString("(/.*)?$")
+	return regexp.Compile(sb.String())
+}
@@ -0,0 +1,107 @@
+package fsplit
+
+import (
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// indexFileName is the name of the file written by Options.Index
+const indexFileName = "fsplit.index.go"
+
+// indexVar is the name of the variable declared by the index file
+const indexVar = "FsplitIndex"
+
+// isSplitFile checks if the file was generated by fsplit from original files
+// The marker may follow Options.Header. The index file is generated as well, but is not one of them.
+func isSplitFile(file *ast.File) bool {
+	for _, comment := range file.Comments {
+		if comment.Pos() > file.Package {
+			break
+		}
+		if strings.HasPrefix(comment.Text(), generatedMarker) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeIndex writes the index file mapping every function in the files generated by fsplit to its file
+// The index is built from the package as it is after the run, not only from this run, so re-runs keep it complete.
+// Init functions and the unsplit files of Options.BuildTag are left out, and a function declared in several files,
+// such as one per build constraint, is mapped to the first of them. The index file is recorded in the result if it changed.
+func writeIndex(packagePath string, opts Options, result *Result) error {
+	fsys := opts.fileSystem()
+	fset := token.NewFileSet()
+	pkgs, err := parseDir(fset, fsys, packagePath, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return err
+	}
+
+	for _, pkg := range sortedPackages(pkgs) {
+		if strings.HasSuffix(pkg.Name, "_test") {
+			continue
+		}
+		index := make(map[string]string)
+		for _, fileName := range sortedFileNames(pkg) {
+			file := pkg.Files[fileName]
+			if isTestFile(fileName) || !isSplitFile(file) || isUnsplitFileName(fileName, opts.splitSuffix()) {
+				continue
+			}
+			for _, decl := range file.Decls {
+				funcDecl, ok := decl.(*ast.FuncDecl)
+				if !ok || (funcDecl.Name.Name == "init" && funcDecl.Recv == nil) {
+					continue
+				}
+				name := qualifiedFuncName(funcDecl)
+				if other, ok := index[name]; ok {
+					opts.logf("index %s to %s, also declared in %s", name, other, filepath.Base(fileName))
+					continue
+				}
+				index[name] = filepath.Base(fileName)
+			}
+		}
+
+		content, err := indexSource(pkg.Name, index)
+		if err != nil {
+			return err
+		}
+		fileName := filepath.Join(packagePath, indexFileName)
+		written, err := writeFileIfChanged(fsys, fileName, content, 0644)
+		if err != nil {
+			return err
+		}
+		if written {
+			opts.logf("index %d functions in %s", len(index), fileName)
+			result.Indexes = append(result.Indexes, fileName)
+		}
+	}
+	return nil
+}
+
+// indexSource returns the content of the index file declaring the map of function names to file names
+func indexSource(pkgName string, index map[string]string) ([]byte, error) {
+	names := make([]string, 0, len(index))
+	for name := range index {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var sb strings.Builder
+	sb.WriteString("// Code generated by fsplit; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&sb, "package %s\n\n", pkgName)
+	fmt.Fprintf(&sb, "// %s maps the functions split by fsplit to the files they were written to\n", indexVar)
+	sb.WriteString("// Methods are named Type.Method.\n")
+	fmt.Fprintf(&sb, "var %s = map[string]string{\n", indexVar)
+	for _, name := range names {
+		fmt.Fprintf(&sb, "\t%s: %s,\n", strconv.Quote(name), strconv.Quote(index[name]))
+	}
+	sb.WriteString("}\n")
+	return format.Source([]byte(sb.String()))
+}
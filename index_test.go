@@ -0,0 +1,27 @@
+package fsplit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIndexVerify(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"a.go": "package p\n\nfunc A() {}\n\nfunc B() {}\n",
+	})
+	_, files := runFsplit(t, dir, Options{Index: true, Verify: true})
+	if !strings.Contains(files[indexFileName], `"A": "a._.A.fsplit.go"`) {
+		t.Fatalf("%s does not list A:\n%s", indexFileName, files[indexFileName])
+	}
+
+	// The re-run finds the index it is about to rewrite
+	if err := os.WriteFile(filepath.Join(dir, "b.go"), []byte("package p\n\nfunc C() {}\n\nfunc D() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, files = runFsplit(t, dir, Options{Index: true, Verify: true})
+	if !strings.Contains(files[indexFileName], `"C": "b._.C.fsplit.go"`) {
+		t.Errorf("%s does not list C after the re-run:\n%s", indexFileName, files[indexFileName])
+	}
+}
@@ -0,0 +1,243 @@
+package fsplit
+
+import (
+	"go/ast"
+	"go/token"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// Layout decides which functions are split into their own files
+type Layout string
+
+const (
+	// LayoutSingle splits every function into its own file
+	LayoutSingle Layout = "single"
+	// LayoutHybrid splits exported functions and methods into their own files.
+	// Unexported methods are grouped with the definition of their receiver type,
+	// and unexported functions stay in the original file.
+	LayoutHybrid Layout = "hybrid"
+)
+
+// isValid checks if the layout is known
+// The empty layout is the same as LayoutSingle.
+func (l Layout) isValid() bool {
+	switch l {
+	case "", LayoutSingle, LayoutHybrid:
+		return true
+	}
+	return false
+}
+
+// isExtracted checks if the function is split into its own file
+func isExtracted(fset *token.FileSet, fileName string, decl *ast.FuncDecl, opts Options) bool {
+	if opts.MinLines > 0 && funcLines(fset, decl) < opts.MinLines {
+		return false
+	}
+	if opts.Include != nil && !opts.Include.MatchString(qualifiedFuncName(decl)) {
+		return false
+	}
+	if opts.Exclude != nil && opts.Exclude.MatchString(qualifiedFuncName(decl)) {
+		return false
+	}
+	if opts.funcs != nil && !opts.funcs[qualifiedFuncName(decl)] {
+		return false
+	}
+	if opts.signature != "" && normalizeSignature(decl.Type) != opts.signature {
+		return false
+	}
+	if opts.ChangedSince != "" && !isChanged(fset, decl, opts.changed[fileName]) {
+		return false
+	}
+
+	switch getTestFuncKind(fileName, decl) {
+	case testFuncMain:
+		if opts.KeepTestMain {
+			return false
+		}
+	case testFuncExample:
+		if opts.SkipExamples {
+			return false
+		}
+	}
+
+	// Methods follow the same rule based on the method name
+	if opts.ExportedOnly && !decl.Name.IsExported() {
+		return false
+	}
+
+	switch opts.Layout {
+	case LayoutHybrid:
+		return decl.Name.IsExported()
+	}
+	return true
+}
+
+// keptFunction returns the function kept in the original file by Options.KeepOne, or nil
+// It is the function named Options.KeepOne, with methods named Type.Method, or the first function of the file if there is none.
+func keptFunction(file *ast.File, opts Options) *ast.FuncDecl {
+	if opts.KeepOne == "" {
+		return nil
+	}
+	var first *ast.FuncDecl
+	for _, decl := range file.Decls {
+		funcDecl, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		if qualifiedFuncName(funcDecl) == opts.KeepOne {
+			return funcDecl
+		}
+		if first == nil {
+			first = funcDecl
+		}
+	}
+	return first
+}
+
+// isCaughtAll checks if the function is gathered into the Options.CatchAll file
+// These are the functions that would be extracted if they were not shorter than Options.MinLines.
+// Functions of files with build constraints stay in place, since the constraint applies to the whole file.
+func isCaughtAll(fset *token.FileSet, fileName string, file *ast.File, decl *ast.FuncDecl, opts Options) bool {
+	if opts.CatchAll == "" || opts.MinLines <= 0 || funcLines(fset, decl) >= opts.MinLines || buildConstraint(file) != "" {
+		return false
+	}
+	opts.MinLines = 0
+	return isExtracted(fset, fileName, decl, opts)
+}
+
+// funcLines returns the number of source lines the function spans, from the func keyword to the closing brace
+func funcLines(fset *token.FileSet, decl *ast.FuncDecl) int {
+	return fset.Position(decl.End()).Line - fset.Position(decl.Pos()).Line + 1
+}
+
+// movedFunction is a function moved from its original file into another file
+type movedFunction struct {
+	// decl is the function declaration
+	decl *ast.FuncDecl
+	// file is the original file of the function
+	file *ast.File
+}
+
+// movedFunctions returns the functions moved into other existing files, keyed by the destination file name
+// Functions mapped to an existing file by Options.FileMapping are moved into that file.
+// Under LayoutHybrid, unexported methods are moved into the file defining their receiver type,
+// and methods already in that file stay in place.
+// With Options.ConstructorWithType, constructors are moved into the file defining their type as well.
+func movedFunctions(fset *token.FileSet, pkg *ast.Package, opts Options, created map[string]bool) map[string][]movedFunction {
+	var typeFiles map[string]string
+	if opts.Layout == LayoutHybrid || opts.ConstructorWithType {
+		typeFiles = findTypeFiles(pkg, opts)
+	}
+
+	moves := make(map[string][]movedFunction)
+	for fileName, file := range pkg.Files {
+		if skip, _ := isNotTarget(fileName, file, opts); skip {
+			continue
+		}
+		kept := keptFunction(file, opts)
+		for _, decl := range file.Decls {
+			funcDecl, ok := decl.(*ast.FuncDecl)
+			if !ok || funcDecl == kept {
+				continue
+			}
+			if dest, mapping := resolveMapping(fileName, funcDecl, pkg, opts, created); mapping != notMapped {
+				if mapping == mappedToExistingFile {
+					moves[dest] = append(moves[dest], movedFunction{decl: funcDecl, file: file})
+				}
+				continue
+			}
+			if typeName := constructorType(funcDecl, typeFiles, opts); typeName != "" {
+				if isExtracted(fset, fileName, funcDecl, opts) || isCaughtAll(fset, fileName, file, funcDecl, opts) {
+					if dest := typeFiles[typeName]; dest != fileName {
+						moves[dest] = append(moves[dest], movedFunction{decl: funcDecl, file: file})
+					}
+				}
+				continue
+			}
+			if opts.Layout != LayoutHybrid || funcDecl.Recv == nil || isExtracted(fset, fileName, funcDecl, opts) || isCaughtAll(fset, fileName, file, funcDecl, opts) {
+				continue
+			}
+			dest, ok := typeFiles[getRecvTypeName(funcDecl)]
+			if ok && dest != fileName {
+				moves[dest] = append(moves[dest], movedFunction{decl: funcDecl, file: file})
+			}
+		}
+	}
+
+	// Keep the source order across files, or sort by name, so that the destination files are predictable
+	for _, funcs := range moves {
+		slices.SortFunc(funcs, func(a, b movedFunction) int {
+			if opts.SortByName {
+				return strings.Compare(qualifiedFuncName(a.decl), qualifiedFuncName(b.decl))
+			}
+			pa, pb := fset.Position(a.decl.Pos()), fset.Position(b.decl.Pos())
+			if c := strings.Compare(pa.Filename, pb.Filename); c != 0 {
+				return c
+			}
+			return pa.Offset - pb.Offset
+		})
+	}
+	return moves
+}
+
+// constructorType returns the type constructed by the function under Options.ConstructorWithType, or an empty string
+// Constructors are functions named New<T> or new<T> for a type T of typeFiles.
+// The type name may start in lower case, as in newFoo for type foo.
+func constructorType(decl *ast.FuncDecl, typeFiles map[string]string, opts Options) string {
+	if !opts.ConstructorWithType || decl.Recv != nil {
+		return ""
+	}
+	for _, prefix := range []string{"New", "new"} {
+		name, ok := strings.CutPrefix(decl.Name.Name, prefix)
+		if !ok || name == "" {
+			continue
+		}
+		for _, typeName := range []string{name, strings.ToLower(name[:1]) + name[1:]} {
+			if _, ok := typeFiles[typeName]; ok {
+				return typeName
+			}
+		}
+	}
+	return ""
+}
+
+// findTypeFiles finds the file defining each type in the package
+func findTypeFiles(pkg *ast.Package, opts Options) map[string]string {
+	typeFiles := make(map[string]string)
+	for fileName, file := range pkg.Files {
+		if skip, reason := isNotTarget(fileName, file, opts); skip && reason != skipTooFewFuncs {
+			continue
+		}
+		for _, decl := range file.Decls {
+			if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.TYPE {
+				for _, spec := range genDecl.Specs {
+					typeFiles[spec.(*ast.TypeSpec).Name.Name] = fileName
+				}
+			}
+		}
+	}
+	return typeFiles
+}
+
+// addImports adds the imports of the src file to the dst file
+// Blank and dot imports are not added. Unused imports are expected to be removed afterwards.
+func addImports(fset *token.FileSet, dst *ast.File, src *ast.File) {
+	for _, spec := range src.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := ""
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if name == "_" || name == "." {
+			continue
+		}
+		astutil.AddNamedImport(fset, dst, name, path)
+	}
+}
@@ -0,0 +1,102 @@
+package fsplit
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestHybridLayout(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"a.go": "package p\n\ntype T struct{}\n\nfunc (T) Exported() {}\n\nfunc (t *T) unexported() {}\n\nfunc (u U) fromA() {}\n\nfunc F() {}\n\nfunc g() {}\n",
+		"b.go": "package p\n\ntype U int\n",
+	})
+	_, files := runFsplit(t, dir, Options{Layout: LayoutHybrid})
+	if want := []string{"a.T.Exported.fsplit.go", "a._.F.fsplit.go", "a.go", "b.go"}; !slices.Equal(fileNames(files), want) {
+		t.Fatalf("files = %v, want %v", fileNames(files), want)
+	}
+	// Unexported methods join their type, and unexported functions stay
+	want := map[string]string{
+		"a.go": "package p\n\ntype T struct{}\n\nfunc (t *T) unexported() {}\n\nfunc g() {}\n",
+		"b.go": "package p\n\ntype U int\n\nfunc (u U) fromA() {}\n",
+	}
+	for name, content := range want {
+		if files[name] != content {
+			t.Errorf("%s =\n%s\nwant\n%s", name, files[name], content)
+		}
+	}
+}
+
+func TestCatchAll(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"a.go": "package p\n\nfunc Short() {}\n\nfunc Long() {\n\t_ = 1\n\t_ = 2\n}\n\nfunc Tiny() {}\n",
+	})
+	_, files := runFsplit(t, dir, Options{MinLines: 3, CatchAll: "small"})
+	if want := []string{"a._.Long.fsplit.go", "a.go", "small.fsplit.go"}; !slices.Equal(fileNames(files), want) {
+		t.Fatalf("files = %v, want %v", fileNames(files), want)
+	}
+	want := "// Code generated by fsplit from a.go; DO NOT EDIT.\n\npackage p\n\nfunc Short() {}\n\nfunc Tiny() {}\n"
+	if files["small.fsplit.go"] != want {
+		t.Errorf("small.fsplit.go =\n%s\nwant\n%s", files["small.fsplit.go"], want)
+	}
+}
+
+func TestGatheredSourceOrder(t *testing.T) {
+	files := map[string]string{
+		"a.go": "package p\n\nfunc Y() {}\n\nfunc X() {}\n",
+		"b.go": "package p\n\nfunc Z() {}\n\nfunc M() {}\n",
+	}
+	tests := []struct {
+		sortByName bool
+		want       string
+	}{
+		// Files in name order, and the functions of each in source order
+		{false, "func Y() {}\n\nfunc X() {}\n\nfunc Z() {}\n\nfunc M() {}\n"},
+		{true, "func M() {}\n\nfunc X() {}\n\nfunc Y() {}\n\nfunc Z() {}\n"},
+	}
+	for _, tt := range tests {
+		dir := writePackage(t, files)
+		_, got := runFsplit(t, dir, Options{MinLines: 3, CatchAll: "small", SortByName: tt.sortByName})
+		want := "// Code generated by fsplit from a.go, b.go; DO NOT EDIT.\n\npackage p\n\n" + tt.want
+		if got["small.fsplit.go"] != want {
+			t.Errorf("with SortByName %v, small.fsplit.go =\n%s\nwant\n%s", tt.sortByName, got["small.fsplit.go"], want)
+		}
+	}
+}
+
+func TestConstructorWithType(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"a.go": "package p\n\ntype T struct{}\n\nfunc NewT() *T { return &T{} }\n\nfunc newU() u { return 0 }\n\nfunc A() {}\n\nfunc B() {}\n",
+		"b.go": "package p\n\ntype u int\n",
+	})
+	_, files := runFsplit(t, dir, Options{ConstructorWithType: true})
+	if want := []string{"a._.A.fsplit.go", "a._.B.fsplit.go", "a.go", "b.go"}; !slices.Equal(fileNames(files), want) {
+		t.Fatalf("files = %v, want %v", fileNames(files), want)
+	}
+	// A constructor declared in another file than its type moves to the type
+	want := map[string]string{
+		"a.go": "package p\n\ntype T struct{}\n\nfunc NewT() *T { return &T{} }\n",
+		"b.go": "package p\n\ntype u int\n\nfunc newU() u { return 0 }\n",
+	}
+	for name, content := range want {
+		if files[name] != content {
+			t.Errorf("%s =\n%s\nwant\n%s", name, files[name], content)
+		}
+	}
+}
+
+func TestKeepOne(t *testing.T) {
+	files := map[string]string{
+		"a.go": "package p\n\ntype T struct{}\n\nfunc A() {}\n\nfunc (T) M() {}\n\nfunc B() {}\n",
+		"b.go": "package p\n\nfunc C() {}\n\nfunc D() {}\n",
+	}
+	// b.go has no T.M, so its first function stays instead
+	dir := writePackage(t, files)
+	_, got := runFsplit(t, dir, Options{KeepOne: "T.M"})
+	want := []string{"a._.A.fsplit.go", "a._.B.fsplit.go", "a.go", "b._.D.fsplit.go", "b.go"}
+	if !slices.Equal(fileNames(got), want) {
+		t.Fatalf("files = %v, want %v", fileNames(got), want)
+	}
+	if got["a.go"] != "package p\n\ntype T struct{}\n\nfunc (T) M() {}\n" || got["b.go"] != "package p\n\nfunc C() {}\n" {
+		t.Errorf("a.go =\n%s\nb.go =\n%s\nwant T.M and C kept", got["a.go"], got["b.go"])
+	}
+}
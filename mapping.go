@@ -0,0 +1,106 @@
+package fsplit
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+)
+
+// mappingKind describes how Options.FileMapping places a function
+type mappingKind int
+
+const (
+	// notMapped means the function is not in the mapping
+	notMapped mappingKind = iota
+	// mappedToNewFile means the function is extracted into a file created by fsplit
+	mappedToNewFile
+	// mappedToOwnFile means the function is mapped to its original file and stays in place
+	mappedToOwnFile
+	// mappedToExistingFile means the function is moved into another existing file of the package
+	mappedToExistingFile
+)
+
+// qualifiedFuncName returns the name of the function prefixed with the receiver type name for methods
+func qualifiedFuncName(decl *ast.FuncDecl) string {
+	if recv := getRecvTypeName(decl); recv != "" {
+		return recv + "." + decl.Name.Name
+	}
+	return decl.Name.Name
+}
+
+// resolveMapping resolves the file the function is mapped to by Options.FileMapping
+// Mapped file names are relative to the package directory.
+// Files in created were created during this run and are not considered as existing files.
+func resolveMapping(fileName string, decl *ast.FuncDecl, pkg *ast.Package, opts Options, created map[string]bool) (string, mappingKind) {
+	target, ok := opts.FileMapping[qualifiedFuncName(decl)]
+	if !ok {
+		return "", notMapped
+	}
+	target = filepath.Join(filepath.Dir(fileName), target)
+	switch {
+	case target == fileName:
+		return target, mappedToOwnFile
+	case pkg.Files[target] != nil && !created[target]:
+		return target, mappedToExistingFile
+	}
+	return target, mappedToNewFile
+}
+
+// mergeFunctionFiles merges single function files with the same file name into one file
+// The package declaration of the first file is used, and the imports of all files are merged.
+func mergeFunctionFiles(funcFiles []SingleFunctionFile) ([]SingleFunctionFile, error) {
+	var merged []SingleFunctionFile
+	index := make(map[string]int)
+	needsImports := make(map[string]bool)
+	for _, funcFile := range funcFiles {
+		i, ok := index[funcFile.FileName]
+		if !ok {
+			index[funcFile.FileName] = len(merged)
+			merged = append(merged, funcFile)
+			continue
+		}
+		merged[i].Func += "\n\n" + funcFile.Func
+		if merged[i].Imports != funcFile.Imports {
+			merged[i].Imports += funcFile.Imports
+			needsImports[funcFile.FileName] = true
+		}
+	}
+
+	for i, funcFile := range merged {
+		if !needsImports[funcFile.FileName] {
+			continue
+		}
+		imports, err := mergeImports(funcFile.Package, funcFile.Imports)
+		if err != nil {
+			return nil, err
+		}
+		merged[i].Imports = imports
+	}
+	return merged, nil
+}
+
+// mergeImports merges the import declarations into a single import declaration without duplicates
+func mergeImports(packageDecl string, imports string) (string, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), "", packageDecl+imports, parser.ImportsOnly)
+	if err != nil {
+		return "", err
+	}
+	var specs []string
+	seen := make(map[string]bool)
+	for _, spec := range file.Imports {
+		s := spec.Path.Value
+		if spec.Name != nil {
+			s = spec.Name.Name + " " + s
+		}
+		if !seen[s] {
+			seen[s] = true
+			specs = append(specs, s)
+		}
+	}
+	if len(specs) == 0 {
+		return "", nil
+	}
+	return "import (\n\t" + strings.Join(specs, "\n\t") + "\n)\n", nil
+}
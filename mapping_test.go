@@ -0,0 +1,67 @@
+package fsplit
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFileMapping(t *testing.T) {
+	dir := writePackage(t, map[string]string{"a.go": `package a
+
+import "fmt"
+
+type T struct{}
+
+// NewT returns a new T
+func NewT() *T { return &T{} }
+
+// MustT returns a new T or panics
+func MustT() *T {
+	fmt.Println("must")
+	return NewT()
+}
+
+func Other() {}
+`})
+	_, files := runFsplit(t, dir, Options{FileMapping: map[string]string{"NewT": "ctor.go", "MustT": "ctor.go"}})
+
+	if want := []string{"a._.Other.fsplit.go", "a.go", "ctor.go"}; !slices.Equal(fileNames(files), want) {
+		t.Fatalf("files = %v, want %v", fileNames(files), want)
+	}
+	want := `package a
+
+import "fmt"
+
+// NewT returns a new T
+func NewT() *T { return &T{} }
+
+// MustT returns a new T or panics
+func MustT() *T {
+	fmt.Println("must")
+	return NewT()
+}
+`
+	if got := files["ctor.go"]; got != want {
+		t.Errorf("ctor.go =\n%s\nwant\n%s", got, want)
+	}
+	if !strings.HasPrefix(files["a._.Other.fsplit.go"], "// Code generated by fsplit from a.go; DO NOT EDIT.\n") {
+		t.Errorf("a._.Other.fsplit.go is not marked as generated:\n%s", files["a._.Other.fsplit.go"])
+	}
+	if want := "package a\n\ntype T struct{}\n"; files["a.go"] != want {
+		t.Errorf("a.go =\n%s\nwant\n%s", files["a.go"], want)
+	}
+}
+
+func TestFileMappingWithSuffix(t *testing.T) {
+	dir := writePackage(t, map[string]string{"a.go": `package a
+
+func A() {}
+
+func B() {}
+`})
+	_, files := runFsplit(t, dir, Options{FileMapping: map[string]string{"A": "ab.fsplit.go", "B": "ab.fsplit.go"}})
+	if !strings.HasPrefix(files["ab.fsplit.go"], "// Code generated by fsplit from a.go; DO NOT EDIT.\n") {
+		t.Errorf("ab.fsplit.go is not marked as generated:\n%s", files["ab.fsplit.go"])
+	}
+}
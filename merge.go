@@ -0,0 +1,212 @@
+package fsplit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// generatedMarker starts the comment marking a file as generated by fsplit, followed by its original files
+const generatedMarker = "Code generated by fsplit from "
+
+// MergeResult describes the files joined back by RunFmerge
+type MergeResult struct {
+	// Merged maps the original files to the generated files joined back into them, in name order
+	Merged map[string][]string
+}
+
+// RunFmerge joins the single function files generated by fsplit in the package back into their original files
+// and deletes them. The functions are appended to the end of their original file, which is created again
+// if it was deleted as empty. If typeName is not empty, only the files of the methods of that receiver type,
+// like foo.T.Method.fsplit.go for T, are joined and the other generated files are left alone.
+// Files gathering functions from several original files, like the catch-all file, are left alone as well.
+// Options.Suffix, Options.Format, Options.Verbose and Options.FileSystem apply.
+// Every change is staged in memory and only written once the whole run succeeded.
+func RunFmerge(packagePath string, typeName string, opts Options) (*MergeResult, error) {
+	fsys := opts.fileSystem()
+	staged := newOverlayFileSystem(fsys)
+	opts.FileSystem = staged
+	result, err := stageFmerge(packagePath, typeName, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := commitPlan(fsys, staged.plan()); err != nil {
+		return nil, fmt.Errorf("Error writing files, changes were rolled back: %v", err)
+	}
+	return result, nil
+}
+
+// stageFmerge joins the generated files back as described for RunFmerge on the file system of opts
+func stageFmerge(packagePath string, typeName string, opts Options) (*MergeResult, error) {
+	fsys := opts.fileSystem()
+	fset := token.NewFileSet()
+	pkgs, err := parseDir(fset, fsys, packagePath, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &MergeResult{Merged: make(map[string][]string)}
+	files := make(map[string]*ast.File)
+	for _, pkg := range sortedPackages(pkgs) {
+		for _, fileName := range sortedFileNames(pkg) {
+			file := pkg.Files[fileName]
+			if isUnsplitFileName(fileName, opts.splitSuffix()) {
+				// The functions of the unsplit file would be declared twice
+				return nil, fmt.Errorf("Error merging %s: files split with a build tag cannot be merged", packagePath)
+			}
+			if !isSplitFileName(fileName, opts.splitSuffix()) || !isSplitFile(file) {
+				continue
+			}
+			if _, recv, _, ok := parseSplitFileName(fileName, opts.splitSuffix()); typeName != "" && (!ok || recv != typeName) {
+				continue
+			}
+			sources := splitFileSources(file)
+			if len(sources) != 1 {
+				opts.logf("skip %s: generated from %d files", fileName, len(sources))
+				continue
+			}
+			origin := filepath.Join(packagePath, sources[0])
+			result.Merged[origin] = append(result.Merged[origin], fileName)
+			files[fileName] = file
+		}
+	}
+
+	names, err := scanPackageNames(fsys, packagePath)
+	if err != nil {
+		return nil, err
+	}
+	origins := make([]string, 0, len(result.Merged))
+	for origin := range result.Merged {
+		origins = append(origins, origin)
+	}
+	slices.Sort(origins)
+	for _, origin := range origins {
+		if err := mergeFiles(fset, origin, result.Merged[origin], files, names, opts); err != nil {
+			return nil, fmt.Errorf("Error merging into %s: %v", origin, err)
+		}
+	}
+
+	// Keep the index in line with the generated files that are left
+	if _, err := fsys.Stat(filepath.Join(packagePath, indexFileName)); err == nil && len(origins) > 0 {
+		if err := writeIndex(packagePath, opts, &Result{}); err != nil {
+			return nil, fmt.Errorf("Error writing index: %v", err)
+		}
+	}
+	return result, nil
+}
+
+// mergeFiles appends the declarations of the generated files to the original file and deletes them
+// The imports of the generated files are added after the package clause of the original file,
+// where goimports merges them with its own and removes the unused ones.
+// If the original file does not exist, it is created from the first generated file without its generated marker.
+func mergeFiles(fset *token.FileSet, origin string, splitFiles []string, files map[string]*ast.File, names *packageNames, opts Options) error {
+	fsys := opts.fileSystem()
+	perm := fileMode(fsys, splitFiles[0])
+	bodies := splitFiles
+	src, err := fsys.ReadFile(origin)
+	switch {
+	case err == nil:
+		perm = fileMode(fsys, origin)
+	case errors.Is(err, fs.ErrNotExist):
+		if src, err = fsys.ReadFile(splitFiles[0]); err != nil {
+			return err
+		}
+		src = withoutGeneratedMarker(fset, files[splitFiles[0]], src)
+		bodies = splitFiles[1:]
+		opts.logf("create %s", origin)
+	default:
+		return err
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), origin, src, parser.PackageClauseOnly)
+	if err != nil {
+		return err
+	}
+	clause := packageClause(string(src), int(file.Name.End())-1)
+
+	var imports, decls bytes.Buffer
+	for _, splitFile := range bodies {
+		src, err := fsys.ReadFile(splitFile)
+		if err != nil {
+			return err
+		}
+		i, d := splitFileParts(fset, files[splitFile], src)
+		imports.WriteString(i)
+		decls.WriteString("\n" + d)
+	}
+	merged := clause + imports.String() + string(src[len(clause):]) + decls.String()
+	formatted, err := formatSource(origin, []byte(merged), names, opts)
+	if err != nil {
+		return err
+	}
+	if _, err := writeFileIfChanged(fsys, origin, formatted, perm); err != nil {
+		return err
+	}
+
+	for _, splitFile := range splitFiles {
+		opts.logf("merge %s into %s", splitFile, origin)
+		if err := fsys.Remove(splitFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withoutGeneratedMarker removes the line of the generated marker and the blank line after it from the source of the file
+func withoutGeneratedMarker(fset *token.FileSet, file *ast.File, src []byte) []byte {
+	for _, comment := range file.Comments {
+		if comment.Pos() > file.Package {
+			break
+		}
+		if !strings.HasPrefix(comment.Text(), generatedMarker) {
+			continue
+		}
+		start, end := fset.Position(comment.Pos()).Offset, fset.Position(comment.End()).Offset
+		rest := bytes.TrimPrefix(bytes.TrimPrefix(src[end:], []byte("\n")), []byte("\n"))
+		return append(slices.Clip(src[:start]), rest...)
+	}
+	return src
+}
+
+// splitFileParts returns the import declarations of the generated file and the source after them
+// The source after the package clause is returned if the file has no imports.
+// A comment on the line of the package clause is dropped, since the original file already has it.
+func splitFileParts(fset *token.FileSet, file *ast.File, src []byte) (string, string) {
+	var imports strings.Builder
+	end := file.Name.End()
+	for _, decl := range file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			imports.WriteString("\n")
+			imports.Write(src[fset.Position(gen.Pos()).Offset:fset.Position(gen.End()).Offset])
+			imports.WriteString("\n")
+			end = gen.End()
+		}
+	}
+	rest := string(src[fset.Position(end).Offset:])
+	if i := strings.IndexByte(rest, '\n'); i >= 0 {
+		rest = rest[i+1:]
+	}
+	return imports.String(), rest
+}
+
+// splitFileSources returns the base names of the original files recorded in the generated marker of the file
+func splitFileSources(file *ast.File) []string {
+	for _, comment := range file.Comments {
+		if comment.Pos() > file.Package {
+			break
+		}
+		text, ok := strings.CutPrefix(comment.Text(), generatedMarker)
+		if !ok {
+			continue
+		}
+		text, _, _ = strings.Cut(text, ";")
+		return strings.Split(text, ", ")
+	}
+	return nil
+}
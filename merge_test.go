@@ -0,0 +1,138 @@
+package fsplit
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRunFmergeType(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"a.go": `package a
+
+import (
+	"fmt"
+	"strings"
+)
+
+type T struct{}
+
+type U struct{}
+
+// String returns the name of T
+func (T) String() string { return fmt.Sprint("T") }
+
+func (T) Upper() string { return strings.ToUpper("t") }
+
+func (U) String() string { return "U" }
+
+func F() {}
+`,
+	})
+	runFsplit(t, dir, Options{})
+
+	result, err := RunFmerge(dir, "T", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantMerged := []string{filepath.Join(dir, "a.T.String.fsplit.go"), filepath.Join(dir, "a.T.Upper.fsplit.go")}
+	if got := result.Merged[filepath.Join(dir, "a.go")]; !slices.Equal(got, wantMerged) || len(result.Merged) != 1 {
+		t.Errorf("Merged = %v, want a.go from %v", result.Merged, wantMerged)
+	}
+
+	files := readPackage(t, dir)
+	if want := []string{"a.U.String.fsplit.go", "a._.F.fsplit.go", "a.go"}; !slices.Equal(fileNames(files), want) {
+		t.Fatalf("files = %v, want %v", fileNames(files), want)
+	}
+	want := `package a
+
+import (
+	"fmt"
+	"strings"
+)
+
+type T struct{}
+
+type U struct{}
+
+// String returns the name of T
+func (T) String() string { return fmt.Sprint("T") }
+
+func (T) Upper() string { return strings.ToUpper("t") }
+`
+	if got := files["a.go"]; got != want {
+		t.Errorf("a.go =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRunFmergeAll(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"a.go": `package a // the package a
+
+import "fmt"
+
+func A() { fmt.Println("a") }
+
+func B() {}
+`,
+		"b.go": `package a
+
+type T struct{}
+
+func (t *T) M() {}
+
+func (t *T) N() {}
+`,
+	})
+	runFsplit(t, dir, Options{RemoveEmpty: RemoveEmptyOnly})
+	if _, err := RunFmerge(dir, "", Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	files := readPackage(t, dir)
+	want := map[string]string{
+		"a.go": `package a // the package a
+
+import "fmt"
+
+func A() { fmt.Println("a") }
+
+func B() {}
+`,
+		"b.go": `package a
+
+type T struct{}
+
+func (t *T) M() {}
+
+func (t *T) N() {}
+`,
+	}
+	if !slices.Equal(fileNames(files), fileNames(want)) {
+		t.Fatalf("files = %v, want %v", fileNames(files), fileNames(want))
+	}
+	for name, content := range want {
+		if files[name] != content {
+			t.Errorf("%s =\n%s\nwant\n%s", name, files[name], content)
+		}
+	}
+}
+
+func TestRunFmergeLeavesGroupedFiles(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"a.go": "package a\n\nfunc A() {}\n\nfunc B() {\n\tprintln()\n\tprintln()\n}\n",
+		"b.go": "package a\n\nfunc C() {}\n\nfunc D() {\n\tprintln()\n\tprintln()\n}\n",
+	})
+	runFsplit(t, dir, Options{MinLines: 3, CatchAll: "small"})
+	if _, err := RunFmerge(dir, "", Options{}); err != nil {
+		t.Fatal(err)
+	}
+	files := readPackage(t, dir)
+	if want := []string{"a.go", "b.go", "small.fsplit.go"}; !slices.Equal(fileNames(files), want) {
+		t.Fatalf("files = %v, want %v", fileNames(files), want)
+	}
+	if !strings.Contains(files["a.go"], "func B()") || strings.Contains(files["a.go"], "func A()") {
+		t.Errorf("a.go =\n%s\nwant B merged back and A left in small.fsplit.go", files["a.go"])
+	}
+}
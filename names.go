@@ -0,0 +1,149 @@
+package fsplit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// nameManifestFileName is the name of the manifest mapping hashed file names back to readable ones
+const nameManifestFileName = "fsplit.names.json"
+
+// FlatNames decides how generated files written into Options.OutDir are named
+type FlatNames string
+
+const (
+	// FlatNamesReadable names the files like in the package directory, such as foo._.Bar.fsplit.go
+	FlatNamesReadable FlatNames = "readable"
+	// FlatNamesHash names the files by a hash of the import path of the package and their readable name,
+	// such as 3f2a9c01b7de.fsplit.go, so that they are short and unique across packages.
+	// The readable names are recorded in fsplit.names.json in Options.OutDir.
+	FlatNamesHash FlatNames = "hash"
+)
+
+// isValid checks if the naming is known
+// The empty naming is the same as FlatNamesReadable.
+func (n FlatNames) isValid() bool {
+	switch n {
+	case "", FlatNamesReadable, FlatNamesHash:
+		return true
+	}
+	return false
+}
+
+// NameManifestEntry describes the readable name of a file named by FlatNamesHash
+type NameManifestEntry struct {
+	// Name is the readable name of the file
+	Name string `json:"name"`
+	// Package is the import path of the package of the file
+	Package string `json:"package"`
+	// Source is the name of the original file of the first function of the file
+	Source string `json:"source"`
+	// Functions are the functions of the file, prefixed with the receiver type name for methods
+	Functions []string `json:"functions"`
+}
+
+// packageImportPath returns the import path of the package in the directory
+// It is the module path declared in the closest go.mod joined with the path of the package relative to it,
+// or the absolute directory outside of a module.
+func packageImportPath(fsys FileSystem, packagePath string) (string, error) {
+	dir, root, err := moduleRoot(fsys, packagePath)
+	if err != nil {
+		abs, aerr := filepath.Abs(packagePath)
+		if aerr != nil {
+			return "", aerr
+		}
+		return filepath.ToSlash(abs), nil
+	}
+	data, err := fsys.ReadFile(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(modfile.ModulePath(data)+"/"+filepath.ToSlash(rel), "/."), nil
+}
+
+// hashedFileName returns the name of the file named by a hash of the import path and its readable name
+// The file stays in its directory, and test files keep the _test.go suffix so that they are still built as tests.
+func hashedFileName(importPath, fileName, suffix string) string {
+	sum := sha256.Sum256([]byte(importPath + "/" + filepath.Base(fileName)))
+	ext := ".go"
+	if strings.HasSuffix(fileName, "_test.go") {
+		ext = "_test.go"
+	}
+	return filepath.Join(filepath.Dir(fileName), hex.EncodeToString(sum[:6])+"."+suffix+ext)
+}
+
+// hashFileNames renames the generated files to their hashed names in place
+// It returns the manifest entries of the renamed files, keyed by their new names relative to Options.OutDir.
+func hashFileNames(funcFiles []SingleFunctionFile, opts Options) (map[string]NameManifestEntry, error) {
+	entries := make(map[string]NameManifestEntry)
+	renamed := make(map[string]string)
+	for i, funcFile := range funcFiles {
+		hashed, ok := renamed[funcFile.FileName]
+		if !ok {
+			hashed = hashedFileName(opts.importPath, funcFile.FileName, opts.splitSuffix())
+			renamed[funcFile.FileName] = hashed
+		}
+		key, err := filepath.Rel(opts.OutDir, hashed)
+		if err != nil {
+			return nil, err
+		}
+		key = filepath.ToSlash(key)
+		entry, ok := entries[key]
+		if !ok {
+			entry = NameManifestEntry{
+				Name:    filepath.Base(funcFile.FileName),
+				Package: opts.importPath,
+				Source:  filepath.Base(funcFile.Source),
+			}
+		}
+		entry.Functions = append(entry.Functions, funcFile.FuncName)
+		entries[key] = entry
+		funcFiles[i].FileName = hashed
+	}
+	return entries, nil
+}
+
+// writeNameManifest merges the entries into fsplit.names.json in Options.OutDir
+// Entries of other packages written earlier are kept, so that one manifest covers a recursive run.
+func writeNameManifest(entries map[string]NameManifestEntry, opts Options, result *Result) error {
+	fsys := opts.fileSystem()
+	fileName := filepath.Join(opts.OutDir, nameManifestFileName)
+	manifest := make(map[string]NameManifestEntry)
+	data, err := fsys.ReadFile(fileName)
+	if err == nil {
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for name, entry := range entries {
+		manifest[name] = entry
+	}
+
+	// Maps are encoded with sorted keys, so the manifest is stable
+	data, err = json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	changed, err := writeFileIfChanged(fsys, fileName, append(data, '\n'), 0644)
+	if err != nil {
+		return err
+	}
+	if changed {
+		opts.logf("write %s", fileName)
+		result.NameManifests = append(result.NameManifests, fileName)
+	}
+	return nil
+}
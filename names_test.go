@@ -0,0 +1,52 @@
+package fsplit
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestHashedNamesCollision(t *testing.T) {
+	// Both packages have a file x._.F.fsplit.go and x._.G.fsplit.go, which collide in a flat output directory
+	root := writePackage(t, map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.22\n",
+		"a/x.go": "package a\n\nfunc F() {}\n\nfunc G() {}\n",
+		"b/x.go": "package b\n\nfunc F() {}\n\nfunc G() {}\n",
+	})
+	out := t.TempDir()
+	if _, err := RunFsplitRecursive(root, Options{OutDir: out, FlatNames: FlatNamesHash, NoConfigFile: true}); err != nil {
+		t.Fatal(err)
+	}
+	files := readPackage(t, out)
+	if len(files) != 5 {
+		t.Fatalf("files = %v, want four hashed files and %s", fileNames(files), nameManifestFileName)
+	}
+
+	var manifest map[string]NameManifestEntry
+	if err := json.Unmarshal([]byte(files[nameManifestFileName]), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for name, entry := range manifest {
+		if _, ok := files[name]; !ok {
+			t.Errorf("%s is in the manifest but was not written", name)
+		}
+		if want := hashedFileName(entry.Package, entry.Name, "fsplit"); name != want {
+			t.Errorf("%s is named %s in the manifest, want %s", name, entry.Name, want)
+		}
+		if entry.Source != "x.go" || len(entry.Functions) != 1 {
+			t.Fatalf("%s: source %q and functions %v, want x.go and one function", name, entry.Source, entry.Functions)
+		}
+		got = append(got, entry.Package+" "+entry.Name+" "+entry.Functions[0])
+	}
+	slices.Sort(got)
+	want := []string{
+		"example.com/m/a x._.F.fsplit.go F",
+		"example.com/m/a x._.G.fsplit.go G",
+		"example.com/m/b x._.F.fsplit.go F",
+		"example.com/m/b x._.G.fsplit.go G",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("manifest entries = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,479 @@
+package fsplit
+
+import (
+	"bytes"
+	"cmp"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/imports"
+)
+
+// isSplitFileName checks if the file name is one generated by fsplit with the suffix
+// Files written to a name given by Options.FileMapping are not recognized.
+func isSplitFileName(fileName string, splitSuffix string) bool {
+	return strings.HasSuffix(fileName, "."+splitSuffix+".go") || strings.HasSuffix(fileName, "."+splitSuffix+"_test.go")
+}
+
+// NormalizeImports re-runs goimports over the files generated by fsplit in the package without splitting anything
+// This is useful to re-normalize imports after, for example, a dependency was renamed.
+// It returns the names of the files that changed.
+func NormalizeImports(packagePath string, opts Options) ([]string, error) {
+	fsys := opts.fileSystem()
+	entries, err := fsys.ReadDir(packagePath)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := scanPackageNames(fsys, packagePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	for _, entry := range entries {
+		if entry.IsDir() || !isSplitFileName(entry.Name(), opts.splitSuffix()) {
+			continue
+		}
+		fileName := filepath.Join(packagePath, entry.Name())
+		src, err := fsys.ReadFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+		formatted, err := processImports(fileName, src, names, opts)
+		if err != nil {
+			return nil, err
+		}
+		written, err := writeFileIfChanged(fsys, fileName, formatted, fileMode(fsys, fileName))
+		if err != nil {
+			return nil, err
+		}
+		if written {
+			opts.logf("normalize %s", fileName)
+			changed = append(changed, fileName)
+		} else {
+			opts.logf("unchanged %s", fileName)
+		}
+	}
+	return changed, nil
+}
+
+// Format decides how generated and rewritten files are formatted
+type Format string
+
+const (
+	// FormatGoimports formats files with goimports, which also removes unused imports and adds missing ones
+	FormatGoimports Format = "goimports"
+	// FormatGofmt formats files with gofmt and leaves the import declarations as copied, except for removing unused ones
+	// Missing imports are not added, and the imports are not regrouped, see removeUnusedImports.
+	FormatGofmt Format = "gofmt"
+)
+
+// isValid checks if the format is known
+// The empty format is the same as FormatGoimports.
+func (f Format) isValid() bool {
+	switch f {
+	case "", FormatGoimports, FormatGofmt:
+		return true
+	}
+	return false
+}
+
+// formatSource formats the file with the formatter chosen by Options.Format
+// With goimports, imports goimports cannot resolve are kept if the file uses them, see pinImportNames,
+// and dot imports goimports cannot judge are removed if the file does not use them, see removeUnusedDotImports.
+// With gofmt, the imports the file does not use are removed the same way, see removeUnusedImports.
+// The line endings of the file are kept, see keepLineEndings.
+func formatSource(fileName string, src []byte, names *packageNames, opts Options) ([]byte, error) {
+	if opts.Format == FormatGofmt {
+		pruned, err := removeUnusedImports(fileName, src, names)
+		if err != nil {
+			return nil, err
+		}
+		if pruned, err = removeUnusedDotImports(fileName, pruned, names); err != nil {
+			return nil, err
+		}
+		formatted, err := format.Source(pruned)
+		if err != nil {
+			return nil, err
+		}
+		return keepLineEndings(src, formatted), nil
+	}
+	pinnedSrc, pinned, err := pinImportNames(fileName, src, names)
+	if err != nil {
+		return nil, err
+	}
+	formatted, err := imports.Process(fileName, pinnedSrc, nil)
+	if err != nil {
+		return nil, err
+	}
+	if formatted, err = unpinImportNames(fileName, formatted, pinned); err != nil {
+		return nil, err
+	}
+	if formatted, err = removeUnusedDotImports(fileName, formatted, names); err != nil {
+		return nil, err
+	}
+	return keepLineEndings(src, formatted), nil
+}
+
+// keepLineEndings converts the line endings of the formatted file to CRLF if the source used them
+// gofmt always writes LF, which would otherwise change every line of files with CRLF line endings.
+// Carriage returns in raw strings are discarded by the compiler, so the values of the strings do not change.
+func keepLineEndings(src, formatted []byte) []byte {
+	if !bytes.Contains(src, []byte("\r\n")) {
+		return formatted
+	}
+	lf := bytes.ReplaceAll(formatted, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(lf, []byte("\n"), []byte("\r\n"))
+}
+
+// processImports runs goimports, or gofmt with FormatGofmt, over the generated file
+// With Options.Rewrite, the rewrite rules are applied first.
+func processImports(fileName string, src []byte, names *packageNames, opts Options) ([]byte, error) {
+	rewritten, err := applyRewriteRules(src, opts.Rewrite)
+	if err != nil {
+		return nil, err
+	}
+	formatted, err := formatSource(fileName, rewritten, names, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.SingleImportGroup {
+		if formatted, err = collapseImportGroups(formatted); err != nil {
+			return nil, err
+		}
+	}
+	return keepLineEndings(src, formatted), nil
+}
+
+// packageNames are the names of a package that decide which imports a file of it uses
+type packageNames struct {
+	// declared are the names declared at package level
+	declared map[string]bool
+	// imports maps the paths of imports without a name whose package name is not the one goimports assumes
+	// to the name the files use for them, as far as it can be told without loading the imported packages
+	imports map[string]string
+}
+
+// scanPackageNames returns the names of the package in the directory
+func scanPackageNames(fsys FileSystem, dir string) (*packageNames, error) {
+	pkgs, err := parseDir(token.NewFileSet(), fsys, dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	names := &packageNames{declared: make(map[string]bool), imports: make(map[string]string)}
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				switch decl := decl.(type) {
+				case *ast.FuncDecl:
+					if decl.Recv == nil {
+						names.declared[decl.Name.Name] = true
+					}
+				case *ast.GenDecl:
+					for _, spec := range decl.Specs {
+						switch spec := spec.(type) {
+						case *ast.TypeSpec:
+							names.declared[spec.Name.Name] = true
+						case *ast.ValueSpec:
+							for _, name := range spec.Names {
+								names.declared[name.Name] = true
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	// Names attributed differently by two files are dropped, since neither can be trusted
+	conflicts := make(map[string]bool)
+	for _, pkg := range sortedPackages(pkgs) {
+		for _, fileName := range sortedFileNames(pkg) {
+			importPath, name := unassumedImportName(pkg.Files[fileName], names)
+			if importPath == "" || conflicts[importPath] {
+				continue
+			}
+			if other, ok := names.imports[importPath]; ok && other != name {
+				delete(names.imports, importPath)
+				conflicts[importPath] = true
+				continue
+			}
+			names.imports[importPath] = name
+		}
+	}
+	return names, nil
+}
+
+// unassumedImportName returns the path and name of the import without a name the file uses by another name
+// than goimports assumes, such as quux for "example.com/qux"
+// Without type information, this is only known if exactly one such import is not used by its assumed name
+// and exactly one name is neither declared, predeclared nor the name of an import. Otherwise it returns "".
+func unassumedImportName(file *ast.File, names *packageNames) (string, string) {
+	unresolved := make(map[string]bool)
+	for _, ident := range file.Unresolved {
+		unresolved[ident.Name] = true
+	}
+	var candidates []string
+	importNames := make(map[string]bool)
+	for _, spec := range file.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return "", ""
+		}
+		switch {
+		case spec.Name == nil:
+			assumed := assumedPackageName(importPath)
+			importNames[assumed] = true
+			if !unresolved[assumed] {
+				candidates = append(candidates, importPath)
+			}
+		case spec.Name.Name == ".":
+			// The name may come from the dot import
+			return "", ""
+		default:
+			importNames[spec.Name.Name] = true
+		}
+	}
+	if len(candidates) != 1 {
+		return "", ""
+	}
+	var unknown []string
+	for name := range unresolved {
+		if !names.declared[name] && !importNames[name] && types.Universe.Lookup(name) == nil {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) != 1 {
+		return "", ""
+	}
+	return candidates[0], unknown[0]
+}
+
+// pinImportNames names the imports of the file recorded in names, such as quux "example.com/qux", if the file uses them
+// goimports assumes the package name from the import path when it cannot load the package,
+// so it would see such imports as unused and remove them. It keeps named imports where they are.
+// It returns the pinned import paths, whose names unpinImportNames removes again.
+func pinImportNames(fileName string, src []byte, names *packageNames) ([]byte, []string, error) {
+	if len(names.imports) == 0 {
+		return src, nil, nil
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, fileName, src, parser.ParseComments)
+	if err != nil {
+		return nil, nil, err
+	}
+	unresolved := make(map[string]bool)
+	for _, ident := range file.Unresolved {
+		unresolved[ident.Name] = true
+	}
+	var pinned []string
+	for _, spec := range file.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return nil, nil, err
+		}
+		if name, ok := names.imports[importPath]; ok && spec.Name == nil && unresolved[name] {
+			spec.Name = &ast.Ident{Name: name, NamePos: spec.Path.Pos()}
+			pinned = append(pinned, importPath)
+		}
+	}
+	if len(pinned) == 0 {
+		return src, nil, nil
+	}
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, file); err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), pinned, nil
+}
+
+// unpinImportNames removes the names pinImportNames gave to the imports
+func unpinImportNames(fileName string, src []byte, pinned []string) ([]byte, error) {
+	if len(pinned) == 0 {
+		return src, nil
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, fileName, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	for _, spec := range file.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return nil, err
+		}
+		if slices.Contains(pinned, importPath) {
+			spec.Name = nil
+		}
+	}
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, file); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// removeUnusedDotImports removes the dot imports of the file if nothing in it can refer to them
+// goimports keeps dot imports because it cannot tell which names they provide.
+// Without type information, a name may come from a dot import if it is not declared in the file or
+// the package, is not predeclared and is not the name of another import. If there is none, every dot import is unused.
+// Otherwise all of them are kept, since the name cannot be attributed to one of them.
+func removeUnusedDotImports(fileName string, src []byte, names *packageNames) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, fileName, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	var dotImports []string
+	importNames := make(map[string]bool)
+	for _, spec := range file.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case spec.Name == nil:
+			importNames[cmp.Or(names.imports[importPath], assumedPackageName(importPath))] = true
+		case spec.Name.Name == ".":
+			dotImports = append(dotImports, importPath)
+		default:
+			importNames[spec.Name.Name] = true
+		}
+	}
+	if len(dotImports) == 0 {
+		return src, nil
+	}
+	for _, ident := range file.Unresolved {
+		if !names.declared[ident.Name] && !importNames[ident.Name] && types.Universe.Lookup(ident.Name) == nil {
+			return src, nil
+		}
+	}
+
+	for _, importPath := range dotImports {
+		astutil.DeleteNamedImport(fset, file, ".", importPath)
+	}
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, file); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// removeUnusedImports removes the imports the file does not use, like goimports does, but without adding any
+// An import is used if its name is referred to and not declared in the file. Imports without a name are
+// looked up by the name recorded in names or the one goimports assumes, which may be wrong without loading the package,
+// so they are only removed if every name the file refers to is known otherwise. Blank, dot and cgo imports are kept.
+func removeUnusedImports(fileName string, src []byte, names *packageNames) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, fileName, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	unresolved := make(map[string]bool)
+	for _, ident := range file.Unresolved {
+		unresolved[ident.Name] = true
+	}
+	// used is the name the file refers to the import by, and name is the one in the import declaration, if any
+	type importName struct{ name, used, path string }
+	var imported []importName
+	importNames := make(map[string]bool)
+	for _, spec := range file.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case spec.Name == nil:
+			used := cmp.Or(names.imports[importPath], assumedPackageName(importPath))
+			imported = append(imported, importName{"", used, importPath})
+			importNames[used] = true
+		case spec.Name.Name != "_" && spec.Name.Name != ".":
+			imported = append(imported, importName{spec.Name.Name, spec.Name.Name, importPath})
+			importNames[spec.Name.Name] = true
+		}
+	}
+	known := true
+	for name := range unresolved {
+		if !names.declared[name] && !importNames[name] && types.Universe.Lookup(name) == nil {
+			known = false
+		}
+	}
+
+	removed := false
+	for _, imp := range imported {
+		if imp.name == "" && (imp.path == "C" || !known) {
+			continue
+		}
+		if !unresolved[imp.used] {
+			removed = astutil.DeleteNamedImport(fset, file, imp.name, imp.path) || removed
+		}
+	}
+	if !removed {
+		return src, nil
+	}
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, file); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// assumedPackageName returns the package name goimports assumes for the import path
+// This is the last element without a major version suffix like "/v2" or ".v3", a "go-" prefix
+// and anything from the first character that cannot be part of an identifier.
+func assumedPackageName(importPath string) string {
+	base := path.Base(importPath)
+	if strings.HasPrefix(base, "v") && strings.Trim(base[1:], "0123456789") == "" && path.Dir(importPath) != "." {
+		base = path.Base(path.Dir(importPath))
+	}
+	if i := strings.LastIndex(base, ".v"); i > 0 && strings.Trim(base[i+2:], "0123456789") == "" {
+		base = base[:i]
+	}
+	base = strings.TrimPrefix(base, "go-")
+	if i := strings.IndexFunc(base, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}); i >= 0 {
+		base = base[:i]
+	}
+	return base
+}
+
+// collapseImportGroups removes the blank lines between the import groups of the file
+// gofmt then sorts the imports as a single group.
+func collapseImportGroups(src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	last := 0
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.IMPORT || !genDecl.Lparen.IsValid() {
+			continue
+		}
+		start, end := fset.Position(genDecl.Lparen).Offset, fset.Position(genDecl.Rparen).Offset
+		buf.Write(src[last:start])
+		for _, line := range strings.SplitAfter(string(src[start:end]), "\n") {
+			if strings.TrimSpace(line) != "" {
+				buf.WriteString(line)
+			}
+		}
+		last = end
+	}
+	buf.Write(src[last:])
+	return format.Source(buf.Bytes())
+}
@@ -0,0 +1,253 @@
+package fsplit
+
+import (
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestUnassumedImportName(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		declared []string
+		path     string
+		pkgName  string
+	}{
+		{"unnamed", `import "example.com/qux"; var _ = quux.X`, nil, "example.com/qux", "quux"},
+		{"assumed name", `import "example.com/qux"; var _ = qux.X`, nil, "", ""},
+		{"aliased", `import q "example.com/qux"; var _ = q.X`, nil, "", ""},
+		{"aliased next to unnamed", `import (q "example.com/q"; "example.com/qux"); var _ = q.X + quux.X`, nil, "example.com/qux", "quux"},
+		{"blank next to unnamed", `import (_ "embed"; "example.com/qux"); var _ = quux.X`, nil, "example.com/qux", "quux"},
+		{"dot", `import (. "example.com/dot"; "example.com/qux"); var _ = quux.X`, nil, "", ""},
+		{"two candidates", `import ("example.com/qux"; "example.com/bar"); var _ = quux.X + baz.X`, nil, "", ""},
+		{"declared in the package", `import "example.com/qux"; var _ = quux.X + other`, []string{"other"}, "example.com/qux", "quux"},
+		{"two unknown names", `import "example.com/qux"; var _ = quux.X + other`, nil, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := parser.ParseFile(token.NewFileSet(), "a.go", "package p; "+tt.src, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := &packageNames{declared: make(map[string]bool), imports: make(map[string]string)}
+			for _, name := range tt.declared {
+				names.declared[name] = true
+			}
+			path, name := unassumedImportName(file, names)
+			if path != tt.path || name != tt.pkgName {
+				t.Errorf("unassumedImportName() = %q, %q, want %q, %q", path, name, tt.path, tt.pkgName)
+			}
+		})
+	}
+}
+
+func TestPinImportNames(t *testing.T) {
+	names := &packageNames{declared: map[string]bool{}, imports: map[string]string{"example.com/qux": "quux"}}
+	tests := []struct {
+		name   string
+		imp    string
+		use    string
+		pinned string
+	}{
+		{"unnamed", `"example.com/qux"`, "quux.X", `quux "example.com/qux"`},
+		{"unnamed and unused", `"example.com/qux"`, "1", ""},
+		{"aliased", `q "example.com/qux"`, "q.X", ""},
+		{"dot", `. "example.com/qux"`, "X", ""},
+		{"blank", `_ "example.com/qux"`, "1", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := "package p\n\nimport " + tt.imp + "\n\nvar _ = " + tt.use + "\n"
+			got, pinned, err := pinImportNames("a.go", []byte(src), names)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.pinned == "" {
+				if len(pinned) > 0 || string(got) != src {
+					t.Fatalf("pinImportNames() pinned %v:\n%s", pinned, got)
+				}
+				return
+			}
+			if !slices.Equal(pinned, []string{"example.com/qux"}) || !strings.Contains(string(got), "import "+tt.pinned+"\n") {
+				t.Fatalf("pinImportNames() pinned %v:\n%s", pinned, got)
+			}
+			unpinned, err := unpinImportNames("a.go", got, pinned)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(unpinned) != src {
+				t.Errorf("unpinImportNames() = %q, want %q", unpinned, src)
+			}
+		})
+	}
+}
+
+func TestFormatSourceKeepsUnassumedImports(t *testing.T) {
+	names := &packageNames{declared: map[string]bool{}, imports: map[string]string{"example.com/qux": "quux"}}
+	src := "package p\n\nimport (\n\t\"example.com/qux\"\n\t\"strings\"\n)\n\nvar _ = quux.X\n"
+	got, err := formatSource("a.go", []byte(src), names, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(got), "\t\"example.com/qux\"\n") || strings.Contains(string(got), "strings") || strings.Contains(string(got), "quux \"") {
+		t.Errorf("formatSource() did not keep the unnamed import and drop the unused one:\n%s", got)
+	}
+}
+
+func TestSpecialImports(t *testing.T) {
+	dir := writePackage(t, map[string]string{"a.go": `package p
+
+import (
+	_ "embed"
+	. "math"
+	str "strings"
+)
+
+func A() string { return str.ToUpper("a") }
+
+func B() float64 { return Pi }
+
+func C() {}
+`})
+	_, files := runFsplit(t, dir, Options{})
+	// The blank import is kept everywhere for its side effects, and the alias and the dot import only where they are used
+	want := map[string]string{
+		"a.go":            "import (\n\t_ \"embed\"\n)\n",
+		"a._.A.fsplit.go": "import (\n\t_ \"embed\"\n\tstr \"strings\"\n)\n",
+		"a._.B.fsplit.go": "import (\n\t_ \"embed\"\n\t. \"math\"\n)\n",
+		"a._.C.fsplit.go": "import (\n\t_ \"embed\"\n)\n",
+	}
+	for name, imports := range want {
+		if !strings.Contains(files[name], "package p\n\n"+imports) {
+			t.Errorf("%s =\n%s\nwant the imports\n%s", name, files[name], imports)
+		}
+	}
+}
+
+func TestSingleImportGroup(t *testing.T) {
+	src := "package p\n\nimport (\n\t\"fmt\"\n\t\"strings\"\n\n\t\"example.com/x\"\n)\n\nfunc A() { fmt.Println(strings.ToUpper(x.S)) }\n\nfunc B() {}\n"
+	tests := []struct {
+		single bool
+		want   string
+	}{
+		{false, "import (\n\t\"fmt\"\n\t\"strings\"\n\n\t\"example.com/x\"\n)\n"},
+		{true, "import (\n\t\"example.com/x\"\n\t\"fmt\"\n\t\"strings\"\n)\n"},
+	}
+	for _, tt := range tests {
+		dir := writePackage(t, map[string]string{"a.go": src})
+		_, files := runFsplit(t, dir, Options{SingleImportGroup: tt.single})
+		if !strings.Contains(files["a._.A.fsplit.go"], "package p\n\n"+tt.want+"\n") {
+			t.Errorf("with SingleImportGroup %v, a._.A.fsplit.go =\n%s\nwant the imports\n%s", tt.single, files["a._.A.fsplit.go"], tt.want)
+		}
+	}
+}
+
+func TestNormalizeImports(t *testing.T) {
+	files := map[string]string{
+		"a.go":            "package p\n\nimport (\n\t\"strings\"\n\t\"fmt\"\n)\n\nvar _ = fmt.Sprint\n",
+		"a._.A.fsplit.go": "// Code generated by fsplit from a.go; DO NOT EDIT.\n\npackage p\n\nimport (\n\t\"strings\"\n\t\"fmt\"\n)\n\nfunc A() { fmt.Println() }\n",
+		"a._.B.fsplit.go": "// Code generated by fsplit from a.go; DO NOT EDIT.\n\npackage p\n\nfunc B() {}\n",
+	}
+	dir := writePackage(t, files)
+	changed, err := NormalizeImports(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{filepath.Join(dir, "a._.A.fsplit.go")}; !slices.Equal(changed, want) {
+		t.Errorf("changed %v, want %v", changed, want)
+	}
+	got := readPackage(t, dir)
+	if want := "// Code generated by fsplit from a.go; DO NOT EDIT.\n\npackage p\n\nimport (\n\t\"fmt\"\n)\n\nfunc A() { fmt.Println() }\n"; got["a._.A.fsplit.go"] != want {
+		t.Errorf("a._.A.fsplit.go =\n%s\nwant\n%s", got["a._.A.fsplit.go"], want)
+	}
+	// Only files generated by fsplit are touched
+	for _, name := range []string{"a.go", "a._.B.fsplit.go"} {
+		if got[name] != files[name] {
+			t.Errorf("%s was changed:\n%s", name, got[name])
+		}
+	}
+}
+
+func TestGofmtBuilds(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"go.mod": "module example.com/p\n\ngo 1.22\n",
+		"a.go": `package p
+
+import (
+	"fmt"
+	m "math"
+	"math/rand/v2"
+	"strings"
+)
+
+var x = 1
+
+func A() { fmt.Println(x) }
+
+func B() string { return strings.ToUpper("b") }
+
+func C() float64 { return m.Pi }
+
+func D() int { return rand.IntN(2) }
+`,
+	})
+	_, files := runFsplit(t, dir, Options{Format: FormatGofmt})
+	// Only the unused imports are removed, and the order of the others is kept
+	want := map[string]string{
+		"a.go":            "package p\n\nvar x = 1\n",
+		"a._.A.fsplit.go": "import (\n\t\"fmt\"\n)\n",
+		"a._.C.fsplit.go": "import (\n\tm \"math\"\n)\n",
+		"a._.D.fsplit.go": "import (\n\t\"math/rand/v2\"\n)\n",
+	}
+	for name, content := range want {
+		if !strings.Contains(files[name], content) {
+			t.Errorf("%s =\n%s\nwant it to contain\n%s", name, files[name], content)
+		}
+	}
+
+	cmd := exec.Command("go", "build", "./...")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("go build after the split: %v\n%s", err, out)
+	}
+}
+
+func TestRemoveUnusedImports(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"unused", `import ("fmt"; "strings"); var _ = fmt.Sprint`, `import ("fmt"); var _ = fmt.Sprint`},
+		{"aliased", `import (f "fmt"; "strings"); var _ = strings.ToUpper`, `import ("strings"); var _ = strings.ToUpper`},
+		{"blank, dot and cgo", `import (_ "embed"; . "math"; "C"); var _ = Pi`, `import (_ "embed"; . "math"; "C"); var _ = Pi`},
+		{"unknown name", `import ("example.com/qux"; "strings"); var _ = quux.X`, `import ("example.com/qux"; "strings"); var _ = quux.X`},
+		{"shadowed", `import "fmt"; func f(fmt int) int { return fmt }`, `func f(fmt int) int { return fmt }`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names := &packageNames{declared: map[string]bool{}, imports: map[string]string{}}
+			got, err := removeUnusedImports("a.go", []byte("package p; "+tt.src), names)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err = format.Source(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := format.Source([]byte("package p; " + tt.want))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("removeUnusedImports() =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package fsplit
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPackLines(t *testing.T) {
+	const src = `package p
+
+func A() {
+	println("A")
+}
+
+func B() {
+	println("B")
+}
+
+func C() {
+	println("C")
+}
+
+func D() {
+	println("D")
+}
+
+func E() {
+	println("E")
+}
+`
+	tests := []struct {
+		name  string
+		opts  Options
+		packs map[string][]string
+	}{
+		{"plain", Options{PackLines: 7}, map[string][]string{
+			"a.pack1.fsplit.go": {"A", "B"},
+			"a.pack2.fsplit.go": {"C", "D"},
+			"a._.E.fsplit.go":   {"E"},
+		}},
+		{"order", Options{PackLines: 7, Order: true}, map[string][]string{
+			"a.0001.pack1.fsplit.go": {"A", "B"},
+			"a.0003.pack2.fsplit.go": {"C", "D"},
+			"a.0005._.E.fsplit.go":   {"E"},
+		}},
+		{"one pack", Options{PackLines: 100}, map[string][]string{
+			"a.pack1.fsplit.go": {"A", "B", "C", "D", "E"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writePackage(t, map[string]string{"a.go": src})
+			_, files := runFsplit(t, dir, tt.opts)
+			want := []string{"a.go"}
+			for name := range tt.packs {
+				want = append(want, name)
+			}
+			slices.Sort(want)
+			if got := fileNames(files); !slices.Equal(got, want) {
+				t.Fatalf("files = %v, want %v", got, want)
+			}
+			for name, funcs := range tt.packs {
+				for _, f := range funcs {
+					if !strings.Contains(files[name], "func "+f+"()") {
+						t.Errorf("%s lacks %s:\n%s", name, f, files[name])
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package fsplit
+
+import (
+	"go/ast"
+	"go/build/constraint"
+	"path/filepath"
+	"strings"
+)
+
+// pathMarker is the comment marker giving the path a function is clustered under
+// It can be placed in the doc comment of a function or before the package clause to apply to the whole file.
+const pathMarker = "//fsplit:path "
+
+// markedPath returns the path given by a marker in the comment group, or an empty string
+func markedPath(comment *ast.CommentGroup) string {
+	if comment == nil {
+		return ""
+	}
+	for _, c := range comment.List {
+		if path, ok := strings.CutPrefix(c.Text, pathMarker); ok {
+			return strings.TrimSpace(path)
+		}
+	}
+	return ""
+}
+
+// functionPath returns the path a function is clustered under with Options.PathNames
+// The path is taken from, in order of precedence:
+// 1. a marker in the doc comment of the function
+// 2. a marker before the package clause of the file
+// 3. the build constraint of the file
+// If none of them is present, it returns an empty string.
+func functionPath(decl *ast.FuncDecl, file *ast.File) string {
+	if path := markedPath(decl.Doc); path != "" {
+		return path
+	}
+	for _, comment := range file.Comments {
+		if comment.Pos() >= file.Package {
+			break
+		}
+		if path := markedPath(comment); path != "" {
+			return path
+		}
+	}
+	return sanitizePathSegment(buildConstraint(file))
+}
+
+// buildConstraint returns the //go:build constraint of the file, or an empty string if it has none
+func buildConstraint(file *ast.File) string {
+	for _, comment := range file.Comments {
+		if comment.Pos() >= file.Package {
+			break
+		}
+		for _, c := range comment.List {
+			if expr, err := constraint.Parse(c.Text); err == nil && constraint.IsGoBuild(c.Text) {
+				return expr.String()
+			}
+		}
+	}
+	return ""
+}
+
+// sanitizePathSegment turns a string into a segment usable in a file name
+// Negations become "not_", and any other character that is not a letter, a digit or a slash becomes an underscore.
+func sanitizePathSegment(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '!':
+			sb.WriteString("not_")
+		case r == '/' || r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9':
+			sb.WriteRune(r)
+		default:
+			sb.WriteRune('_')
+		}
+	}
+	segments := strings.FieldsFunc(sb.String(), func(r rune) bool { return r == '_' })
+	return strings.Join(segments, "_")
+}
+
+// withPath prefixes the base name of the file with the path, flattened with dots
+// Go packages cannot span directories, so a path like "http/handlers" turns
+// foo._.Serve.fsplit.go into http.handlers.foo._.Serve.fsplit.go, keeping related functions together.
+func withPath(fileName string, path string) string {
+	var segments []string
+	for _, segment := range strings.Split(filepath.ToSlash(path), "/") {
+		if segment = sanitizePathSegment(segment); segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	if len(segments) == 0 {
+		return fileName
+	}
+	dir, base := filepath.Split(fileName)
+	return dir + strings.Join(segments, ".") + "." + base
+}
@@ -0,0 +1,42 @@
+package fsplit
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestQualifyNames(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"a.go":      "package p\n\nfunc A() {}\n\nfunc B() {}\n",
+		"a_test.go": "package p_test\n\nimport \"testing\"\n\nfunc TestA(t *testing.T) {}\n\nfunc TestB(t *testing.T) {}\n",
+	})
+	_, files := runFsplit(t, dir, Options{QualifyNames: true, IncludeTests: true})
+	want := []string{"a.go", "a_test.go", "p.a._.A.fsplit.go", "p.a._.B.fsplit.go", "p_test.a._.TestA.fsplit_test.go", "p_test.a._.TestB.fsplit_test.go"}
+	if !slices.Equal(fileNames(files), want) {
+		t.Errorf("files = %v, want %v", fileNames(files), want)
+	}
+}
+
+func TestPathNames(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"a.go": `package p
+
+//fsplit:path http/handlers
+func Serve() {}
+
+func Plain() {}
+`,
+		"b.go": "//fsplit:path db\n\npackage p\n\nfunc Query() {}\n\n//fsplit:path cache\nfunc Get() {}\n",
+		"c.go": "//go:build linux && !cgo\n\npackage p\n\nfunc Open() {}\n\nfunc Close() {}\n",
+	})
+	_, files := runFsplit(t, dir, Options{PathNames: true})
+	// The marker of a function wins over the marker of its file, which wins over the build constraint
+	want := []string{
+		"a._.Plain.fsplit.go", "a.go", "b.go", "c.go",
+		"cache.b._.Get.fsplit.go", "db.b._.Query.fsplit.go", "http.handlers.a._.Serve.fsplit.go",
+		"linux_not_cgo.c._.Close.fsplit.go", "linux_not_cgo.c._.Open.fsplit.go",
+	}
+	if !slices.Equal(fileNames(files), want) {
+		t.Errorf("files = %v, want %v", fileNames(files), want)
+	}
+}
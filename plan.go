@@ -0,0 +1,263 @@
+package fsplit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Plan describes the changes a run would make, so that they can be reviewed or edited before they are applied
+// It is created by PlanFsplit and applied by ApplyPlan without analyzing the package again.
+type Plan struct {
+	// Manifest describes the planned split for review
+	// It is not used when the plan is applied.
+	Manifest Manifest `json:"manifest"`
+	// Writes are the files to write
+	Writes []PlannedWrite `json:"writes"`
+	// Removes are the files to remove after every write is done
+	Removes []string `json:"removes"`
+}
+
+// PlannedWrite is a file to write with its full content
+type PlannedWrite struct {
+	// File is the name of the file
+	File string `json:"file"`
+	// Mode is the permissions of the file
+	Mode os.FileMode `json:"mode"`
+	// Content is the content of the file
+	Content string `json:"content"`
+}
+
+// PlanFsplit runs the fsplit tool with the given options without modifying anything
+// It returns the plan of the changes the run would make.
+func PlanFsplit(packagePath string, opts Options) (*Plan, error) {
+	return PlanFsplitContext(context.Background(), packagePath, opts)
+}
+
+// PlanFsplitContext runs the fsplit tool with the given options without modifying anything
+// The run reads from the file system of opts and keeps every change in memory.
+func PlanFsplitContext(ctx context.Context, packagePath string, opts Options) (*Plan, error) {
+	overlay := newOverlayFileSystem(opts.fileSystem())
+	opts.FileSystem = overlay
+	result, err := RunFsplitWithOptionsContext(ctx, packagePath, opts)
+	if err != nil {
+		return nil, err
+	}
+	plan := overlay.plan()
+	plan.Manifest = result.Manifest()
+	return plan, nil
+}
+
+// ApplyPlan performs the writes and removals of the plan on the file system of opts
+func ApplyPlan(plan *Plan, opts Options) error {
+	fsys := opts.fileSystem()
+	for _, w := range plan.Writes {
+		if err := fsys.WriteFile(w.File, []byte(w.Content), w.Mode.Perm()); err != nil {
+			return err
+		}
+		opts.logf("write %s", w.File)
+	}
+	for _, name := range plan.Removes {
+		if err := fsys.Remove(name); err != nil {
+			return err
+		}
+		opts.logf("remove %s", name)
+	}
+	return nil
+}
+
+// commitPlan performs the writes and removals of the plan like ApplyPlan
+// If one of them fails, the files touched so far are restored, so that either the whole plan is applied or nothing.
+func commitPlan(fsys FileSystem, plan *Plan) error {
+	snap := make(snapshot)
+	for _, name := range append(plannedFiles(plan), plan.Removes...) {
+		content, err := fsys.ReadFile(name)
+		if err == nil {
+			snap[filepath.Clean(name)] = snapshotFile{content: content, perm: fileMode(fsys, name)}
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	var touched []string
+	rollback := func(err error) error {
+		if rerr := snap.restore(fsys, touched); rerr != nil {
+			return fmt.Errorf("%v (rollback failed: %v)", err, rerr)
+		}
+		return err
+	}
+	for _, w := range plan.Writes {
+		touched = append(touched, w.File)
+		if err := fsys.WriteFile(w.File, []byte(w.Content), w.Mode.Perm()); err != nil {
+			return rollback(err)
+		}
+	}
+	for _, name := range plan.Removes {
+		touched = append(touched, name)
+		if err := fsys.Remove(name); err != nil {
+			return rollback(err)
+		}
+	}
+	return nil
+}
+
+// plannedFiles returns the names of the files the plan writes
+func plannedFiles(plan *Plan) []string {
+	names := make([]string, len(plan.Writes))
+	for i, w := range plan.Writes {
+		names[i] = w.File
+	}
+	return names
+}
+
+// JSON renders the plan as indented JSON
+func (p *Plan) JSON() ([]byte, error) {
+	return json.MarshalIndent(p, "", "  ")
+}
+
+// ReadPlan parses a plan rendered by Plan.JSON
+func ReadPlan(data []byte) (*Plan, error) {
+	var plan Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// overlayFileSystem is a FileSystem that reads from base but keeps every change in memory
+// It is safe for concurrent use, since single function files are written concurrently.
+type overlayFileSystem struct {
+	base    FileSystem
+	mu      sync.Mutex
+	written map[string]overlayFile
+	removed map[string]bool
+}
+
+// overlayFile is a file written to an overlayFileSystem
+// It implements both fs.FileInfo and fs.DirEntry.
+type overlayFile struct {
+	name    string
+	content []byte
+	perm    os.FileMode
+}
+
+func (f overlayFile) Name() string               { return filepath.Base(f.name) }
+func (f overlayFile) Size() int64                { return int64(len(f.content)) }
+func (f overlayFile) Mode() fs.FileMode          { return f.perm }
+func (f overlayFile) ModTime() time.Time         { return time.Time{} }
+func (f overlayFile) IsDir() bool                { return false }
+func (f overlayFile) Sys() any                   { return nil }
+func (f overlayFile) Type() fs.FileMode          { return 0 }
+func (f overlayFile) Info() (fs.FileInfo, error) { return f, nil }
+
+func newOverlayFileSystem(base FileSystem) *overlayFileSystem {
+	return &overlayFileSystem{
+		base:    base,
+		written: make(map[string]overlayFile),
+		removed: make(map[string]bool),
+	}
+}
+
+func (o *overlayFileSystem) ReadFile(name string) ([]byte, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	name = filepath.Clean(name)
+	if f, ok := o.written[name]; ok {
+		return f.content, nil
+	}
+	if o.removed[name] {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return o.base.ReadFile(name)
+}
+
+func (o *overlayFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	name = filepath.Clean(name)
+	o.written[name] = overlayFile{name: name, content: slices.Clone(data), perm: perm}
+	delete(o.removed, name)
+	return nil
+}
+
+func (o *overlayFileSystem) Stat(name string) (fs.FileInfo, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	name = filepath.Clean(name)
+	if f, ok := o.written[name]; ok {
+		return f, nil
+	}
+	if o.removed[name] {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return o.base.Stat(name)
+}
+
+func (o *overlayFileSystem) Remove(name string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	name = filepath.Clean(name)
+	if _, ok := o.written[name]; !ok {
+		if _, err := o.base.Stat(name); err != nil || o.removed[name] {
+			return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+		}
+	}
+	delete(o.written, name)
+	o.removed[name] = true
+	return nil
+}
+
+func (o *overlayFileSystem) ReadDir(name string) ([]fs.DirEntry, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	name = filepath.Clean(name)
+	base, err := o.base.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	var entries []fs.DirEntry
+	for _, entry := range base {
+		path := filepath.Join(name, entry.Name())
+		if _, ok := o.written[path]; !ok && !o.removed[path] {
+			entries = append(entries, entry)
+		}
+	}
+	for path, f := range o.written {
+		if filepath.Dir(path) == name {
+			entries = append(entries, f)
+		}
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return entries, nil
+}
+
+// plan returns the changes kept in memory as a plan
+// Removed files that do not exist in base, such as created files cleaned up after an error, are omitted.
+func (o *overlayFileSystem) plan() *Plan {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	plan := &Plan{Writes: []PlannedWrite{}, Removes: []string{}}
+	for name, f := range o.written {
+		plan.Writes = append(plan.Writes, PlannedWrite{File: name, Mode: f.perm, Content: string(f.content)})
+	}
+	slices.SortFunc(plan.Writes, func(a, b PlannedWrite) int {
+		return strings.Compare(a.File, b.File)
+	})
+	for name := range o.removed {
+		if _, err := o.base.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+			plan.Removes = append(plan.Removes, name)
+		}
+	}
+	slices.Sort(plan.Removes)
+	return plan
+}
@@ -0,0 +1,70 @@
+package fsplit
+
+import (
+	"maps"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var planFiles = map[string]string{
+	"a.go": "package p\n\nimport \"fmt\"\n\nfunc A() { fmt.Println() }\n\nfunc B() {}\n",
+}
+
+func TestPlanRoundTrip(t *testing.T) {
+	dir := writePackage(t, planFiles)
+	plan, err := PlanFsplit(dir, Options{NoConfigFile: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readPackage(t, dir); !maps.Equal(got, planFiles) {
+		t.Fatalf("planning modified the package: %v", got)
+	}
+	data, err := plan.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadPlan(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyPlan(read, Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The applied plan leaves the same tree as a plain run
+	_, want := runFsplit(t, writePackage(t, planFiles), Options{})
+	if got := readPackage(t, dir); !maps.Equal(got, want) {
+		t.Errorf("files after ApplyPlan = %v, want %v", got, want)
+	}
+}
+
+func TestPlanEdited(t *testing.T) {
+	dir := writePackage(t, planFiles)
+	plan, err := PlanFsplit(dir, Options{NoConfigFile: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The reviewer renames the file of B and documents B
+	edited := filepath.Join(dir, "b.go")
+	for i, w := range plan.Writes {
+		if filepath.Base(w.File) == "a._.B.fsplit.go" {
+			plan.Writes[i].File = edited
+			plan.Writes[i].Content = strings.Replace(w.Content, "func B", "// B does nothing\nfunc B", 1)
+		}
+	}
+	if err := ApplyPlan(plan, Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := readPackage(t, dir)
+	if _, ok := got["a._.B.fsplit.go"]; ok {
+		t.Error("a._.B.fsplit.go was written although the plan no longer contains it")
+	}
+	if !strings.Contains(got["b.go"], "// B does nothing\nfunc B() {}\n") {
+		t.Errorf("b.go =\n%s\nwant the edited content", got["b.go"])
+	}
+	if err := typeCheck(t, dir); err != nil {
+		t.Errorf("the package does not type check after the edited plan: %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+package fsplit
+
+import "sync"
+
+// progress reports the files processed by a phase to Options.OnProgress
+// It is safe for concurrent use, and calls to the callback are serialized.
+type progress struct {
+	mu     sync.Mutex
+	done   int
+	total  int
+	report func(done, total int, currentFile string)
+}
+
+func newProgress(total int, opts Options) *progress {
+	return &progress{total: total, report: opts.OnProgress}
+}
+
+// step reports that the file was processed
+func (p *progress) step(fileName string) {
+	if p.report == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	p.report(p.done, p.total, fileName)
+}
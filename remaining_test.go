@@ -0,0 +1,111 @@
+package fsplit
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+func TestRemainingDeclarations(t *testing.T) {
+	files := map[string]string{
+		"types.go": `package p
+
+type T struct{ n int }
+
+type (
+	U int
+	V string
+)
+
+const Max = 10
+
+var defaultT = T{n: Max}
+
+func (t T) N() int { return t.n }
+`,
+		"funcs.go": `package p
+
+const step = 2
+
+func NewT() T { return defaultT }
+
+func (t *T) Inc() { t.n += step }
+
+func helper() int { return step }
+`,
+		// The dotted stem must not be confused with funcs.go
+		"funcs.x.go": `package p
+
+var names = []string{"a", "b"}
+
+type W struct{}
+
+func Names() []string { return names }
+
+func (w W) String() string { return "w" }
+`,
+	}
+	// The non-function declarations of every original file
+	want := map[string][]string{
+		"types.go":   {"T", "U", "V", "Max", "defaultT"},
+		"funcs.go":   {"step"},
+		"funcs.x.go": {"names", "W"},
+	}
+	tests := []struct {
+		name    string
+		opts    Options
+		renamed map[string]string
+	}{
+		{"single", Options{}, nil},
+		{"hybrid", Options{Layout: LayoutHybrid}, nil},
+		{"constructor with type", Options{ConstructorWithType: true}, nil},
+		{"keep one", Options{KeepOne: "first"}, nil},
+		{"remaining suffix", Options{RemainingSuffix: "rest"}, map[string]string{"funcs.go": "funcs.rest.go", "funcs.x.go": "funcs.x.rest.go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writePackage(t, files)
+			tt.opts.Verify = true
+			_, after := runFsplit(t, dir, tt.opts)
+
+			declared := make(map[string][]string)
+			for fileName, src := range after {
+				file, err := parser.ParseFile(token.NewFileSet(), fileName, src, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, decl := range file.Decls {
+					gen, ok := decl.(*ast.GenDecl)
+					if !ok {
+						continue
+					}
+					for _, spec := range gen.Specs {
+						switch spec := spec.(type) {
+						case *ast.TypeSpec:
+							declared[spec.Name.Name] = append(declared[spec.Name.Name], fileName)
+						case *ast.ValueSpec:
+							for _, name := range spec.Names {
+								declared[name.Name] = append(declared[name.Name], fileName)
+							}
+						}
+					}
+				}
+			}
+			for original, names := range want {
+				remaining := original
+				if renamed, ok := tt.renamed[original]; ok {
+					remaining = renamed
+				}
+				for _, name := range names {
+					if got := declared[name]; len(got) != 1 || got[0] != remaining {
+						t.Errorf("%s is declared in %v, want only in %s", name, got, remaining)
+					}
+				}
+			}
+			if n := len(declared); n != 8 {
+				t.Errorf("%d names are declared, want 8: %v", n, declared)
+			}
+		})
+	}
+}
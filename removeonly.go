@@ -0,0 +1,110 @@
+package fsplit
+
+import (
+	"fmt"
+	"go/ast"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// splitFunction identifies a function by the name of a generated file, like foo.T.Method.fsplit.go
+type splitFunction struct {
+	// test is whether the generated file is a test file
+	test bool
+	// name is the function name, prefixed with the receiver type name for methods
+	name string
+}
+
+// splitFunctions are the functions that have generated files in the package
+type splitFunctions struct {
+	funcs map[splitFunction]bool
+	// inits are the stems of the generated file names of init functions, keyed by their init-NNN name
+	inits map[splitFunction][]string
+}
+
+// readSplitFunctions collects the functions encoded in the names of the generated files in the package directory
+// Names of files grouping several functions, like init.fsplit.go or the catch-all file, do not encode a function and are ignored.
+func readSplitFunctions(fsys FileSystem, packagePath string, opts Options) (splitFunctions, error) {
+	entries, err := fsys.ReadDir(packagePath)
+	if err != nil {
+		return splitFunctions{}, err
+	}
+	split := splitFunctions{funcs: make(map[splitFunction]bool), inits: make(map[splitFunction][]string)}
+	for _, entry := range entries {
+		if entry.IsDir() || !isSplitFileName(entry.Name(), opts.splitSuffix()) {
+			continue
+		}
+		test := isTestFile(entry.Name())
+		stem, recv, name, ok := parseSplitFileName(entry.Name(), opts.splitSuffix())
+		if !ok {
+			continue
+		}
+		if strings.HasPrefix(name, "init-") && recv == "_" {
+			f := splitFunction{test: test, name: name}
+			split.inits[f] = append(split.inits[f], stem)
+			continue
+		}
+		if recv != "_" {
+			name = recv + "." + name
+		}
+		split.funcs[splitFunction{test: test, name: name}] = true
+	}
+	return split, nil
+}
+
+// parseSplitFileName returns the parts of the name of a single function file, like foo.T.Method.fsplit.go:
+// the stem of its original file, the receiver type name, or "_" for functions, and the function name
+// Suffixes added by Options.CaseSafeNames are removed. ok is false for names that do not encode a function,
+// such as init.fsplit.go or the catch-all file.
+func parseSplitFileName(fileName string, splitSuffix string) (stem, recv, name string, ok bool) {
+	base := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(fileName), ".go"), "_test")
+	parts := strings.Split(strings.TrimSuffix(base, "."+splitSuffix), ".")
+	if len(parts) < 3 {
+		return "", "", "", false
+	}
+	return strings.Join(parts[:len(parts)-2], "."), parts[len(parts)-2], trimCaseSuffix(parts[len(parts)-1]), true
+}
+
+// removedSplitFunctions returns the functions of the original file that have generated files
+// The n-th init function of a file is removed if a generated init-00n file has the stem of the file.
+func removedSplitFunctions(fileName string, file *ast.File, split splitFunctions) []*ast.FuncDecl {
+	test := isTestFile(fileName)
+	stem := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(fileName), ".go"), "_test")
+	var removed []*ast.FuncDecl
+	initCnt := 0
+	for _, decl := range file.Decls {
+		funcDecl, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		if funcDecl.Name.Name == "init" && funcDecl.Recv == nil {
+			initCnt++
+			f := splitFunction{test: test, name: fmt.Sprintf("init-%03d", initCnt)}
+			for _, s := range split.inits[f] {
+				if s == stem || strings.HasSuffix(s, "."+stem) || strings.HasPrefix(s, stem+".") {
+					removed = append(removed, funcDecl)
+					break
+				}
+			}
+			continue
+		}
+		if split.funcs[splitFunction{test: test, name: qualifiedFuncName(funcDecl)}] {
+			removed = append(removed, funcDecl)
+		}
+	}
+	return removed
+}
+
+// trimCaseSuffix removes the -n suffix added by Options.CaseSafeNames from the function part of a file name
+// The -NNN of init functions is part of their name and is kept.
+func trimCaseSuffix(name string) string {
+	i := strings.LastIndexByte(name, '-')
+	if i < 0 || name[:i] == "init" {
+		return name
+	}
+	if _, err := strconv.Atoi(name[i+1:]); err != nil {
+		return name
+	}
+	return name[:i]
+}
@@ -0,0 +1,56 @@
+package fsplit
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestRemoveOnly(t *testing.T) {
+	dir := writePackage(t, map[string]string{"a.go": `package a
+
+type T struct{}
+
+func (T) M() {}
+
+func F() {}
+
+func G() {}
+`})
+	out := t.TempDir()
+	if _, err := RunFsplitWithOptions(dir, Options{OutDir: out, NoConfigFile: true}); err != nil {
+		t.Fatal(err)
+	}
+	// Only two of the generated files are copied into the package
+	for _, name := range []string{"a.T.M.fsplit.go", "a._.F.fsplit.go"} {
+		content, err := os.ReadFile(filepath.Join(out, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, files := runFsplit(t, dir, Options{RemoveOnly: true})
+	if want := []string{"a.T.M.fsplit.go", "a._.F.fsplit.go", "a.go"}; !slices.Equal(fileNames(files), want) {
+		t.Fatalf("files = %v, want %v", fileNames(files), want)
+	}
+	want := `package a
+
+type T struct{}
+
+func G() {}
+`
+	if got := files["a.go"]; got != want {
+		t.Errorf("a.go =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRemoveOnlyWithOutDir(t *testing.T) {
+	dir := writePackage(t, map[string]string{"a.go": "package a\n\nfunc F() {}\n\nfunc G() {}\n"})
+	if _, err := RunFsplitWithOptions(dir, Options{RemoveOnly: true, OutDir: t.TempDir(), NoConfigFile: true}); err == nil {
+		t.Error("RunFsplitWithOptions succeeded, want an error")
+	}
+}
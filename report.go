@@ -0,0 +1,264 @@
+package fsplit
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Result describes the outcome of a fsplit run
+type Result struct {
+	// Files are the original files that were split, in order of extraction
+	Files []SplitFile
+	// Rewritten are the names of the original files that were rewritten
+	Rewritten []string
+	// Deleted are the names of the original files that were deleted because they became empty
+	Deleted []string
+	// Renamed maps the names of original files renamed by Options.RemainingSuffix to their new names
+	// The new names are also listed in Rewritten.
+	Renamed map[string]string
+	// Skipped are the package directories not started because Options.Deadline passed
+	Skipped []string
+	// SkippedFiles counts the files that were not split by the reason, such as "generated file"
+	SkippedFiles map[string]int
+	// Unsplit are the files keeping the split functions behind the negated Options.BuildTag
+	Unsplit []string
+	// SubPackage are the files written into the sub-package by Options.SubPackage
+	SubPackage []string
+	// DocHTML are the godoc HTML snippets written by Options.DocHTML
+	DocHTML []string
+	// NameManifests are the manifests of hashed file names written by Options.FlatNames, if they changed
+	NameManifests []string
+	// Indexes are the index files written by Options.Index, if they changed
+	Indexes []string
+	// ImportAudit describes the imports of the generated files, if Options.AuditImports is set
+	ImportAudit []ImportAudit
+}
+
+// SplitFile describes an original file and the functions extracted from it
+type SplitFile struct {
+	// Source is the name of the original file
+	Source string
+	// Functions are the functions extracted from the original file
+	Functions []ExtractedFunction
+}
+
+// ExtractedFunction describes a function and the file it was written to
+type ExtractedFunction struct {
+	// Name is the name of the function, prefixed with the receiver type name for methods
+	Name string
+	// Target is the name of the file the function was written to
+	Target string
+	// Vars are the names of the package-level variables moved along with the function
+	Vars []string
+}
+
+// newResult builds the result from the single function files
+func newResult(funcFiles []SingleFunctionFile) *Result {
+	result := &Result{}
+	index := make(map[string]int)
+	for _, funcFile := range funcFiles {
+		i, ok := index[funcFile.Source]
+		if !ok {
+			i = len(result.Files)
+			index[funcFile.Source] = i
+			result.Files = append(result.Files, SplitFile{Source: funcFile.Source})
+		}
+		result.Files[i].Functions = append(result.Files[i].Functions, ExtractedFunction{
+			Name:   funcFile.FuncName,
+			Target: funcFile.FileName,
+			Vars:   funcFile.Vars,
+		})
+	}
+	return result
+}
+
+// Merge appends the outcome of another run to the result
+func (r *Result) Merge(other *Result) {
+	r.Files = append(r.Files, other.Files...)
+	r.Rewritten = append(r.Rewritten, other.Rewritten...)
+	r.Deleted = append(r.Deleted, other.Deleted...)
+	r.Skipped = append(r.Skipped, other.Skipped...)
+	r.Indexes = append(r.Indexes, other.Indexes...)
+	r.Unsplit = append(r.Unsplit, other.Unsplit...)
+	r.SubPackage = append(r.SubPackage, other.SubPackage...)
+	r.DocHTML = append(r.DocHTML, other.DocHTML...)
+	r.NameManifests = append(r.NameManifests, other.NameManifests...)
+	r.ImportAudit = append(r.ImportAudit, other.ImportAudit...)
+	for reason, n := range other.SkippedFiles {
+		if r.SkippedFiles == nil {
+			r.SkippedFiles = make(map[string]int)
+		}
+		r.SkippedFiles[reason] += n
+	}
+	for from, to := range other.Renamed {
+		if r.Renamed == nil {
+			r.Renamed = make(map[string]string)
+		}
+		r.Renamed[from] = to
+	}
+}
+
+// CreatedFiles returns the number of files created by the run
+func (r *Result) CreatedFiles() int {
+	n := 0
+	for _, file := range r.Files {
+		n += len(file.Functions)
+	}
+	return n
+}
+
+// Unchanged reports whether the run left every file as it was
+// This is the case for a package that is already split, since fsplit skips its generated files and single function files.
+func (r *Result) Unchanged() bool {
+	return len(r.changedFiles()) == 0
+}
+
+// writtenFiles returns the names of all files created or rewritten by the run
+func (r *Result) writtenFiles() []string {
+	var files []string
+	for _, file := range r.Files {
+		for _, f := range file.Functions {
+			files = append(files, f.Target)
+		}
+	}
+	files = append(files, r.Unsplit...)
+	files = append(files, r.SubPackage...)
+	files = append(files, r.Indexes...)
+	return append(files, r.Rewritten...)
+}
+
+// changedFiles returns the names of all files created, rewritten, renamed or deleted by the run
+func (r *Result) changedFiles() []string {
+	files := append(r.writtenFiles(), r.Deleted...)
+	// The snippets are not Go files, so they are not in writtenFiles, which are parsed by Options.Verify
+	files = append(files, r.DocHTML...)
+	files = append(files, r.NameManifests...)
+	for from := range r.Renamed {
+		files = append(files, from)
+	}
+	return files
+}
+
+// Summary renders the result as a single line for the end of a run, such as
+// "Split 2 files into 7 single-function files; 2 originals rewritten; 1 files skipped (generated file: 1)."
+func (r *Result) Summary() string {
+	var targets []string
+	for _, file := range r.Files {
+		for _, f := range file.Functions {
+			if !slices.Contains(targets, f.Target) {
+				targets = append(targets, f.Target)
+			}
+		}
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Split %d files into %d single-function files; %d originals rewritten", len(r.Files), len(targets), len(r.Rewritten))
+	if len(r.Deleted) > 0 {
+		fmt.Fprintf(&sb, "; %d originals deleted", len(r.Deleted))
+	}
+	if len(r.SkippedFiles) > 0 {
+		reasons := make([]string, 0, len(r.SkippedFiles))
+		total := 0
+		for reason, n := range r.SkippedFiles {
+			reasons = append(reasons, fmt.Sprintf("%s: %d", reason, n))
+			total += n
+		}
+		slices.Sort(reasons)
+		fmt.Fprintf(&sb, "; %d files skipped (%s)", total, strings.Join(reasons, ", "))
+	}
+	if len(r.Skipped) > 0 {
+		fmt.Fprintf(&sb, "; %d packages skipped after the deadline", len(r.Skipped))
+	}
+	sb.WriteString(".")
+	return sb.String()
+}
+
+// Markdown renders the result as a Markdown summary suitable for a pull request description
+func (r *Result) Markdown() string {
+	var sb strings.Builder
+	sb.WriteString("## fsplit\n\n")
+	if len(r.Files) == 0 {
+		sb.WriteString("No files were split.\n")
+	} else {
+		fmt.Fprintf(&sb, "- Files split: %d\n- Files created: %d\n", len(r.Files), r.CreatedFiles())
+	}
+	if len(r.Deleted) > 0 {
+		fmt.Fprintf(&sb, "- Files deleted: %d\n", len(r.Deleted))
+	}
+	if len(r.Skipped) > 0 {
+		fmt.Fprintf(&sb, "- Packages skipped after the deadline: %s\n", strings.Join(r.Skipped, ", "))
+	}
+	for _, file := range r.Files {
+		fmt.Fprintf(&sb, "\n### `%s`\n\n", file.Source)
+		sb.WriteString("| Function | File |\n")
+		sb.WriteString("| --- | --- |\n")
+		for _, f := range file.Functions {
+			fmt.Fprintf(&sb, "| `%s` | `%s` |\n", f.Name, f.Target)
+		}
+	}
+	return sb.String()
+}
+
+// Manifest is a machine-readable description of the files created and modified by a run
+type Manifest struct {
+	// Created are the files created by the run
+	Created []ManifestEntry `json:"created"`
+	// Modified are the original files rewritten by the run
+	Modified []string `json:"modified"`
+	// Deleted are the original files deleted by the run because they became empty
+	Deleted []string `json:"deleted"`
+	// Renamed maps original files renamed by the run to their new names
+	Renamed map[string]string `json:"renamed"`
+	// Skipped are the package directories not started because the deadline passed
+	Skipped []string `json:"skipped"`
+}
+
+// ManifestEntry describes a created file and where its functions came from
+type ManifestEntry struct {
+	// File is the name of the created file
+	File string `json:"file"`
+	// Source is the name of the original file
+	Source string `json:"source"`
+	// Functions are the names of the functions written to the file
+	Functions []string `json:"functions"`
+}
+
+// Manifest builds the manifest of the result
+// Functions written to the same file are listed in a single entry.
+func (r *Result) Manifest() Manifest {
+	manifest := Manifest{
+		Created:  []ManifestEntry{},
+		Modified: []string{},
+		Deleted:  []string{},
+		Renamed:  map[string]string{},
+		Skipped:  []string{},
+	}
+	index := make(map[string]int)
+	for _, file := range r.Files {
+		for _, f := range file.Functions {
+			if i, ok := index[f.Target]; ok {
+				manifest.Created[i].Functions = append(manifest.Created[i].Functions, f.Name)
+				continue
+			}
+			index[f.Target] = len(manifest.Created)
+			manifest.Created = append(manifest.Created, ManifestEntry{
+				File:      f.Target,
+				Source:    file.Source,
+				Functions: []string{f.Name},
+			})
+		}
+	}
+	manifest.Modified = append(manifest.Modified, r.Rewritten...)
+	manifest.Deleted = append(manifest.Deleted, r.Deleted...)
+	manifest.Skipped = append(manifest.Skipped, r.Skipped...)
+	for from, to := range r.Renamed {
+		manifest.Renamed[from] = to
+	}
+	return manifest
+}
+
+// JSONManifest renders the manifest of the result as indented JSON
+func (r *Result) JSONManifest() ([]byte, error) {
+	return json.MarshalIndent(r.Manifest(), "", "  ")
+}
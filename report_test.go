@@ -0,0 +1,30 @@
+package fsplit
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMarkdown(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"a.go": "package p\n\nfunc A() {}\n\nfunc B() {}\n",
+	})
+	result, _ := runFsplit(t, dir, Options{})
+	// The names are relative to the package for a stable report
+	got := strings.ReplaceAll(result.Markdown(), dir+string(filepath.Separator), "")
+	want := "## fsplit\n" +
+		"\n" +
+		"- Files split: 1\n" +
+		"- Files created: 2\n" +
+		"\n" +
+		"### `a.go`\n" +
+		"\n" +
+		"| Function | File |\n" +
+		"| --- | --- |\n" +
+		"| `A` | `a._.A.fsplit.go` |\n" +
+		"| `B` | `a._.B.fsplit.go` |\n"
+	if got != want {
+		t.Errorf("Markdown() =\n%s\nwant\n%s", got, want)
+	}
+}
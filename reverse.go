@@ -0,0 +1,256 @@
+package fsplit
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"slices"
+	"strings"
+)
+
+// joinedDecl is a top-level declaration of a file taking part in the in-memory join, printed with its comments
+type joinedDecl struct {
+	// file is the name of the file declaring it
+	file string
+	// index is the position of the declaration in the file
+	index int
+	// text is the declaration as gofmt prints it, with its doc comment and the comments inside of it
+	text string
+}
+
+// parsedDecls parses the file and prints its declarations other than imports
+// It also returns the parsed declarations in the same order.
+func parsedDecls(fsys FileSystem, fileName string) ([]joinedDecl, []ast.Decl, error) {
+	src, err := fsys.ReadFile(fileName)
+	if err != nil {
+		return nil, nil, err
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, fileName, src, parser.ParseComments)
+	if err != nil {
+		return nil, nil, err
+	}
+	var decls []joinedDecl
+	var nodes []ast.Decl
+	for i, decl := range file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			continue
+		}
+		start := decl.Pos()
+		if doc := declDoc(decl); doc != nil {
+			start = doc.Pos()
+		}
+		var comments []*ast.CommentGroup
+		for _, c := range file.Comments {
+			if c.Pos() >= start && c.End() <= decl.End() {
+				comments = append(comments, c)
+			}
+		}
+		var buf bytes.Buffer
+		if err := format.Node(&buf, fset, &printer.CommentedNode{Node: decl, Comments: comments}); err != nil {
+			return nil, nil, err
+		}
+		decls = append(decls, joinedDecl{file: fileName, index: i, text: buf.String()})
+		nodes = append(nodes, decl)
+	}
+	return decls, nodes, nil
+}
+
+// declDoc returns the doc comment of the declaration
+func declDoc(decl ast.Decl) *ast.CommentGroup {
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		return decl.Doc
+	case *ast.GenDecl:
+		return decl.Doc
+	}
+	return nil
+}
+
+// verifyReversible checks that joining the split files back would reproduce every original file
+// The join is done in memory: the declarations left in the rewritten original file, the functions moved out of it,
+// into generated files or into other original files, and the variables moved along with them must be exactly
+// the declarations of the original file after gofmt, comments included. The declarations left in place must keep
+// their order, while moved ones are appended when joining, so their position is not compared.
+// Imports are not compared, since goimports prunes them. before holds the original files and after the split ones.
+func verifyReversible(before, after FileSystem, packagePath string, opts Options, result *Result) error {
+	splitFiles, err := joinedFiles(before, packagePath, opts, result)
+	if err != nil {
+		return err
+	}
+
+	type parsed struct {
+		decls []joinedDecl
+		nodes []ast.Decl
+	}
+	files := make(map[string]parsed)
+	parse := func(fileName string) (parsed, error) {
+		if p, ok := files[fileName]; ok {
+			return p, nil
+		}
+		decls, nodes, err := parsedDecls(after, fileName)
+		if err != nil {
+			return parsed{}, err
+		}
+		files[fileName] = parsed{decls: decls, nodes: nodes}
+		return files[fileName], nil
+	}
+
+	// Claim the moved functions and variables first, since a file a function moved into may be an original file as well
+	type claim struct {
+		file  string
+		index int
+	}
+	claimed := make(map[claim]bool)
+	moved := make([][]joinedDecl, len(splitFiles))
+	var errs []error
+	for i, splitFile := range splitFiles {
+		for _, f := range splitFile.Functions {
+			p, err := parse(f.Target)
+			if err != nil {
+				return err
+			}
+			// A variable declaration with several names is claimed once
+			own := make(map[claim]bool)
+			for _, name := range append([]string{f.Name}, f.Vars...) {
+				found := false
+				for j, decl := range p.nodes {
+					c := claim{f.Target, p.decls[j].index}
+					if !declares(decl, name) || (claimed[c] && !own[c]) {
+						continue
+					}
+					if !own[c] {
+						claimed[c], own[c] = true, true
+						moved[i] = append(moved[i], p.decls[j])
+					}
+					found = true
+					break
+				}
+				if !found {
+					errs = append(errs, fmt.Errorf("%s: %s is missing from %s", splitFile.Source, name, f.Target))
+				}
+			}
+		}
+	}
+
+	for i, splitFile := range splitFiles {
+		original, _, err := parsedDecls(before, splitFile.Source)
+		if err != nil {
+			return err
+		}
+		joined := moved[i]
+		remaining := cmp.Or(result.Renamed[splitFile.Source], splitFile.Source)
+		if !slices.Contains(result.Deleted, splitFile.Source) {
+			p, err := parse(remaining)
+			if err != nil {
+				return err
+			}
+			for _, decl := range p.decls {
+				if !claimed[claim{remaining, decl.index}] {
+					joined = append(joined, decl)
+				}
+			}
+		}
+
+		last := -1
+		for _, decl := range original {
+			j := slices.IndexFunc(joined, func(d joinedDecl) bool { return d.text == decl.text })
+			if j < 0 {
+				errs = append(errs, fmt.Errorf("%s: not reproduced by joining: %s", splitFile.Source, firstLine(decl.text)))
+				continue
+			}
+			if joined[j].file == remaining && !claimed[claim{remaining, joined[j].index}] {
+				if joined[j].index < last {
+					errs = append(errs, fmt.Errorf("%s: out of order after splitting: %s", splitFile.Source, firstLine(decl.text)))
+				}
+				last = max(last, joined[j].index)
+			}
+			joined = slices.Delete(joined, j, j+1)
+		}
+		for _, decl := range joined {
+			errs = append(errs, fmt.Errorf("%s: added by joining from %s: %s", splitFile.Source, decl.file, firstLine(decl.text)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// joinedFiles returns the original files to join back with the functions that left them
+// These are the functions extracted into generated files, listed in the result, and those moved into other
+// original files by the layout, the file mapping or Options.ConstructorWithType, which are found again from
+// the original files in before. Original files that only received functions are listed without any,
+// so that they are checked as well.
+func joinedFiles(before FileSystem, packagePath string, opts Options, result *Result) ([]SplitFile, error) {
+	splitFiles := slices.Clone(result.Files)
+	if opts.RemoveOnly {
+		return splitFiles, nil
+	}
+	index := make(map[string]int)
+	created := make(map[string]bool)
+	for i, splitFile := range splitFiles {
+		index[splitFile.Source] = i
+		for _, f := range splitFile.Functions {
+			created[f.Target] = true
+		}
+	}
+	add := func(source string) int {
+		i, ok := index[source]
+		if !ok {
+			i = len(splitFiles)
+			index[source] = i
+			splitFiles = append(splitFiles, SplitFile{Source: source})
+		}
+		return i
+	}
+
+	fset := token.NewFileSet()
+	pkgs, err := parseDir(fset, before, packagePath, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	for _, pkg := range sortedPackages(pkgs) {
+		moves := movedFunctions(fset, pkg, opts, created)
+		dests := make([]string, 0, len(moves))
+		for dest := range moves {
+			dests = append(dests, dest)
+		}
+		slices.Sort(dests)
+		for _, dest := range dests {
+			add(dest)
+			for _, f := range moves[dest] {
+				i := add(fset.Position(f.decl.Pos()).Filename)
+				splitFiles[i].Functions = append(splitFiles[i].Functions, ExtractedFunction{
+					Name:   qualifiedFuncName(f.decl),
+					Target: cmp.Or(result.Renamed[dest], dest),
+				})
+			}
+		}
+	}
+	return splitFiles, nil
+}
+
+// declares checks if the declaration is the function with the qualified name or a variable declaration declaring the name
+func declares(decl ast.Decl, name string) bool {
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		return qualifiedFuncName(decl) == name
+	case *ast.GenDecl:
+		return decl.Tok == token.VAR && slices.Contains(varNames([]*ast.GenDecl{decl}), name)
+	}
+	return false
+}
+
+// firstLine returns the first line of the text that is not a comment, to identify a declaration in messages
+func firstLine(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if !strings.HasPrefix(line, "//") {
+			return line
+		}
+	}
+	return text
+}
@@ -0,0 +1,81 @@
+package fsplit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyReversible(t *testing.T) {
+	files := map[string]string{
+		"a.go": `package p
+
+// T is a type
+type T struct{}
+
+// Get returns the value
+func (t *T) Get() int { return 1 }
+
+func (t *T) reset() {}
+
+func helper() {}
+`,
+		"b.go": `package p
+
+// NewT creates a T
+func NewT() *T { return &T{} }
+
+// Banner stays in place
+
+func (t *T) clear() {}
+
+const limit = 3
+
+func Use() int { return limit }
+`,
+		"c.go": `package p
+
+func Moved() {}
+
+func AlsoMoved() {}
+`,
+	}
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"single", Options{}},
+		{"hybrid", Options{Layout: LayoutHybrid}},
+		{"constructor with type", Options{ConstructorWithType: true}},
+		{"mapped to an existing file", Options{FileMapping: map[string]string{"Moved": "a.go", "AlsoMoved": "a.go"}}},
+		{"remove empty", Options{FileMapping: map[string]string{"Moved": "a.go", "AlsoMoved": "b.go"}, RemoveEmpty: RemoveEmptyOnly}},
+		{"remaining suffix", Options{Layout: LayoutHybrid, RemainingSuffix: "rest"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writePackage(t, files)
+			tt.opts.VerifyReversible = true
+			runFsplit(t, dir, tt.opts)
+		})
+	}
+}
+
+func TestVerifyReversibleLossy(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"a.go": `package p
+
+func A(s string) string {
+	return s[1:len(s)]
+}
+
+func B() {}
+`,
+	})
+	before := readPackage(t, dir)
+	_, err := RunFsplitWithOptions(dir, Options{VerifyReversible: true, NoConfigFile: true, Rewrite: []string{"x[a:len(x)] -> x[a:]"}})
+	if err == nil || !strings.Contains(err.Error(), "a.go: not reproduced by joining: func A(s string) string {") {
+		t.Fatalf("RunFsplitWithOptions() error = %v, want A not reproduced", err)
+	}
+	if after := readPackage(t, dir); len(after) != len(before) || after["a.go"] != before["a.go"] {
+		t.Errorf("the package was changed by a failed verification: %v", fileNames(after))
+	}
+}
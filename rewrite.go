@@ -0,0 +1,251 @@
+package fsplit
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The rewriting below follows gofmt -r, so that rules behave the same as in a project's formatting step.
+
+// rewriteRule is a rule like "a[b:len(a)] -> a[b:]"
+// Single lower-case letters in the pattern are wildcards matching any expression.
+type rewriteRule struct {
+	pattern, replacement ast.Expr
+}
+
+// parseRewriteRule parses a rule of the form "pattern -> replacement"
+func parseRewriteRule(rule string) (rewriteRule, error) {
+	pattern, replacement, ok := strings.Cut(rule, "->")
+	if !ok || strings.Contains(replacement, "->") {
+		return rewriteRule{}, fmt.Errorf("Invalid rewrite rule %q: must be of the form 'pattern -> replacement'", rule)
+	}
+	var r rewriteRule
+	var err error
+	if r.pattern, err = parser.ParseExpr(strings.TrimSpace(pattern)); err != nil {
+		return rewriteRule{}, fmt.Errorf("Invalid rewrite rule %q: %v", rule, err)
+	}
+	if r.replacement, err = parser.ParseExpr(strings.TrimSpace(replacement)); err != nil {
+		return rewriteRule{}, fmt.Errorf("Invalid rewrite rule %q: %v", rule, err)
+	}
+	return r, nil
+}
+
+// applyRewriteRules rewrites the source with each rule in turn and formats it
+// The source is returned as is if there are no rules.
+func applyRewriteRules(src []byte, rules []string) ([]byte, error) {
+	if len(rules) == 0 {
+		return src, nil
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		r, err := parseRewriteRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		file = r.apply(file)
+	}
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, file); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// apply rewrites every match of the pattern in the file, innermost first
+func (r rewriteRule) apply(file *ast.File) *ast.File {
+	m := make(map[string]reflect.Value)
+	pattern, replacement := reflect.ValueOf(r.pattern), reflect.ValueOf(r.replacement)
+	var rewriteVal func(val reflect.Value) reflect.Value
+	rewriteVal = func(val reflect.Value) reflect.Value {
+		if !val.IsValid() {
+			return reflect.Value{}
+		}
+		val = applyFunc(rewriteVal, val)
+		clear(m)
+		if match(m, pattern, val) {
+			val = subst(m, replacement, reflect.ValueOf(val.Interface().(ast.Node).Pos()))
+		}
+		return val
+	}
+	rewritten := applyFunc(rewriteVal, reflect.ValueOf(file)).Interface().(*ast.File)
+	rewritten.Comments = file.Comments
+	return rewritten
+}
+
+// isWildcard checks if the identifier of a pattern is a wildcard, that is a single lower-case letter
+func isWildcard(name string) bool {
+	r, size := utf8.DecodeRuneInString(name)
+	return size == len(name) && unicode.IsLower(r)
+}
+
+var (
+	identType     = reflect.TypeOf((*ast.Ident)(nil))
+	objectPtrType = reflect.TypeOf((*ast.Object)(nil))
+	scopePtrType  = reflect.TypeOf((*ast.Scope)(nil))
+	positionType  = reflect.TypeOf(token.NoPos)
+	callExprType  = reflect.TypeOf((*ast.CallExpr)(nil))
+)
+
+// setValue sets x to y if possible, ignoring values that do not fit, such as an expression in place of an identifier
+func setValue(x, y reflect.Value) {
+	if !x.CanSet() || !y.IsValid() || !y.Type().AssignableTo(x.Type()) {
+		return
+	}
+	x.Set(y)
+}
+
+// applyFunc replaces each child of val with the result of f
+// Objects and scopes are dropped, since they introduce cycles and are stale after rewriting.
+func applyFunc(f func(reflect.Value) reflect.Value, val reflect.Value) reflect.Value {
+	if !val.IsValid() {
+		return reflect.Value{}
+	}
+	switch val.Type() {
+	case objectPtrType, scopePtrType:
+		return reflect.Zero(val.Type())
+	}
+	switch v := reflect.Indirect(val); v.Kind() {
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			e := v.Index(i)
+			setValue(e, f(e))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			e := v.Field(i)
+			setValue(e, f(e))
+		}
+	case reflect.Interface:
+		setValue(v, f(v.Elem()))
+	}
+	return val
+}
+
+// match checks if val matches the pattern, recording the expressions matched by wildcards in m
+// A wildcard used several times must match the same expression each time.
+func match(m map[string]reflect.Value, pattern, val reflect.Value) bool {
+	if m != nil && pattern.IsValid() && pattern.Type() == identType {
+		if id := pattern.Interface().(*ast.Ident); id != nil && isWildcard(id.Name) && val.IsValid() {
+			name := id.Name
+			if _, ok := val.Interface().(ast.Expr); ok && !val.IsNil() {
+				if old, ok := m[name]; ok {
+					return match(nil, old, val)
+				}
+				m[name] = val
+				return true
+			}
+		}
+	}
+
+	if !pattern.IsValid() || !val.IsValid() {
+		return !pattern.IsValid() && !val.IsValid()
+	}
+	if pattern.Type() != val.Type() {
+		return false
+	}
+	switch pattern.Type() {
+	case identType:
+		// Only the names of identifiers matter
+		p, v := pattern.Interface().(*ast.Ident), val.Interface().(*ast.Ident)
+		return p == nil && v == nil || p != nil && v != nil && p.Name == v.Name
+	case objectPtrType, positionType:
+		return true
+	case callExprType:
+		// f(x) and f(x...) differ only in the position of the ellipsis
+		p, v := pattern.Interface().(*ast.CallExpr), val.Interface().(*ast.CallExpr)
+		if p.Ellipsis.IsValid() != v.Ellipsis.IsValid() {
+			return false
+		}
+	}
+
+	p, v := reflect.Indirect(pattern), reflect.Indirect(val)
+	if !p.IsValid() || !v.IsValid() {
+		return !p.IsValid() && !v.IsValid()
+	}
+	switch p.Kind() {
+	case reflect.Slice:
+		if p.Len() != v.Len() {
+			return false
+		}
+		for i := 0; i < p.Len(); i++ {
+			if !match(m, p.Index(i), v.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		for i := 0; i < p.NumField(); i++ {
+			if !match(m, p.Field(i), v.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Interface:
+		return match(m, p.Elem(), v.Elem())
+	}
+	return p.Interface() == v.Interface()
+}
+
+// subst returns a copy of the pattern with wildcards replaced by their matches in m
+// Valid positions are replaced by pos, so that the printer places the result where the match was.
+func subst(m map[string]reflect.Value, pattern reflect.Value, pos reflect.Value) reflect.Value {
+	if !pattern.IsValid() {
+		return reflect.Value{}
+	}
+	if m != nil && pattern.Type() == identType {
+		if id := pattern.Interface().(*ast.Ident); id != nil && isWildcard(id.Name) {
+			if old, ok := m[id.Name]; ok {
+				return subst(nil, old, reflect.Value{})
+			}
+		}
+	}
+	if pos.IsValid() && pattern.Type() == positionType {
+		if !pattern.Interface().(token.Pos).IsValid() {
+			return pattern
+		}
+		return pos
+	}
+
+	switch p := pattern; p.Kind() {
+	case reflect.Slice:
+		if p.IsNil() {
+			return reflect.Zero(p.Type())
+		}
+		v := reflect.MakeSlice(p.Type(), p.Len(), p.Len())
+		for i := 0; i < p.Len(); i++ {
+			v.Index(i).Set(subst(m, p.Index(i), pos))
+		}
+		return v
+	case reflect.Struct:
+		v := reflect.New(p.Type()).Elem()
+		for i := 0; i < p.NumField(); i++ {
+			v.Field(i).Set(subst(m, p.Field(i), pos))
+		}
+		return v
+	case reflect.Pointer:
+		v := reflect.New(p.Type()).Elem()
+		if elem := p.Elem(); elem.IsValid() {
+			v.Set(subst(m, elem, pos).Addr())
+		}
+		return v
+	case reflect.Interface:
+		v := reflect.New(p.Type()).Elem()
+		if elem := p.Elem(); elem.IsValid() {
+			v.Set(subst(m, elem, pos))
+		}
+		return v
+	}
+	return pattern
+}
@@ -0,0 +1,27 @@
+package fsplit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRewriteRule(t *testing.T) {
+	src := "package p\n\nfunc A(s []int, i int) []int { return s[i:len(s)] }\n\nfunc B(s []int) []int { return s[0:len(s)] }\n\nvar c, d []int\n\nvar _ = c[1:len(c)]\n"
+	dir := writePackage(t, map[string]string{"a.go": src})
+	_, files := runFsplit(t, dir, Options{Rewrite: []string{"a[b:len(a)] -> a[b:]"}})
+	if want := "func A(s []int, i int) []int { return s[i:] }\n"; !strings.HasSuffix(files["a._.A.fsplit.go"], want) {
+		t.Errorf("a._.A.fsplit.go =\n%s\nwant it to end with\n%s", files["a._.A.fsplit.go"], want)
+	}
+	if want := "func B(s []int) []int { return s[0:] }\n"; !strings.HasSuffix(files["a._.B.fsplit.go"], want) {
+		t.Errorf("a._.B.fsplit.go =\n%s\nwant it to end with\n%s", files["a._.B.fsplit.go"], want)
+	}
+	// Only generated files are rewritten
+	if !strings.Contains(files["a.go"], "c[1:len(c)]") {
+		t.Errorf("a.go was rewritten:\n%s", files["a.go"])
+	}
+
+	_, err := RunFsplitWithOptions(writePackage(t, map[string]string{"a.go": src}), Options{Rewrite: []string{"a[b:len(a)]"}, NoConfigFile: true})
+	if err == nil || !strings.Contains(err.Error(), "must be of the form 'pattern -> replacement'") {
+		t.Errorf("err = %v, want the invalid rule reported", err)
+	}
+}
@@ -0,0 +1,40 @@
+package fsplit
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/types"
+)
+
+// normalizeSignature prints the function type without parameter names, like "func(context.Context, int) error"
+// Grouped parameters such as "a, b int" are expanded, so that equal signatures print equally.
+// Receivers and type parameters are not part of the signature.
+func normalizeSignature(funcType *ast.FuncType) string {
+	unnamed := func(fields *ast.FieldList) *ast.FieldList {
+		if fields == nil {
+			return nil
+		}
+		list := &ast.FieldList{}
+		for _, field := range fields.List {
+			for range max(len(field.Names), 1) {
+				list.List = append(list.List, &ast.Field{Type: field.Type})
+			}
+		}
+		return list
+	}
+	return types.ExprString(&ast.FuncType{Params: unnamed(funcType.Params), Results: unnamed(funcType.Results)})
+}
+
+// parseSignature parses a signature pattern like "func(context.Context) error" and normalizes it
+func parseSignature(pattern string) (string, error) {
+	expr, err := parser.ParseExpr(pattern)
+	if err != nil {
+		return "", fmt.Errorf("Invalid signature %q: %v", pattern, err)
+	}
+	funcType, ok := expr.(*ast.FuncType)
+	if !ok {
+		return "", fmt.Errorf("Invalid signature %q: not a function type", pattern)
+	}
+	return normalizeSignature(funcType), nil
+}
@@ -0,0 +1,33 @@
+package fsplit
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSignature(t *testing.T) {
+	dir := writePackage(t, map[string]string{"a.go": `package p
+
+import "context"
+
+type T struct{}
+
+func A(ctx context.Context) error { return nil }
+
+func B(context.Context) error { return nil }
+
+func (T) M(c context.Context) (err error) { return nil }
+
+func (*T) N(ctx context.Context) {}
+
+func C(ctx context.Context, n int) error { return nil }
+
+func D() error { return nil }
+`})
+	_, files := runFsplit(t, dir, Options{Signature: "func(context.Context) error"})
+	// Parameter names and receivers do not matter, but every parameter and result type does
+	want := []string{"a.T.M.fsplit.go", "a._.A.fsplit.go", "a._.B.fsplit.go", "a.go"}
+	if !slices.Equal(fileNames(files), want) {
+		t.Errorf("files = %v, want %v", fileNames(files), want)
+	}
+}
@@ -0,0 +1,167 @@
+package fsplit
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// subPackageName is the name and directory of the sub-package written by Options.SubPackage
+const subPackageName = "fsplit"
+
+// subPackageVariants moves the exported, self-contained functions of single function files into the sub-package
+// The generated file in the package keeps a forwarder of the same signature calling the function in the sub-package,
+// so that the package still declares and documents it. A function is self-contained if it refers to no name
+// declared at package level other than its own. Functions of test files, cgo files and files gathering
+// several functions, and functions moved with variables, stay in the package as usual.
+// It returns the files of the sub-package.
+func subPackageVariants(funcFiles []SingleFunctionFile, opts Options) ([]SingleFunctionFile, error) {
+	funcs := make(map[string]int)
+	for _, funcFile := range funcFiles {
+		funcs[funcFile.FileName]++
+	}
+	names := make(map[string]*packageNames)
+	var sub []SingleFunctionFile
+	for i, funcFile := range funcFiles {
+		if funcs[funcFile.FileName] != 1 || !isSplitFileName(funcFile.FileName, opts.splitSuffix()) ||
+			isTestFile(funcFile.Source) || len(funcFile.Vars) > 0 {
+			continue
+		}
+		dir := filepath.Dir(funcFile.Source)
+		if _, ok := names[dir]; !ok {
+			var err error
+			if names[dir], err = scanPackageNames(opts.fileSystem(), dir); err != nil {
+				return nil, err
+			}
+		}
+		forwarder, ok, err := subPackageForwarder(funcFile, names[dir].declared)
+		if err != nil {
+			return nil, fmt.Errorf("Error forwarding %s: %v", funcFile.FuncName, err)
+		}
+		if !ok {
+			continue
+		}
+		opts.logf("move %s into the sub-package %s", funcFile.FuncName, filepath.Join(dir, subPackageName))
+		funcFiles[i].Imports += fmt.Sprintf("import %q\n", opts.importPath+"/"+subPackageName)
+		funcFiles[i].Func = forwarder
+		funcFile.FileName = filepath.Join(dir, subPackageName, filepath.Base(funcFile.FileName))
+		funcFile.Package = subPackageClause(funcFile.Package)
+		sub = append(sub, funcFile)
+	}
+	return sub, nil
+}
+
+// subPackageForwarder returns the function of the file with a body calling the function of the same name in the sub-package
+// It reports false if the function cannot be moved into the sub-package.
+// Unnamed and blank parameters are named so that they can be passed on.
+func subPackageForwarder(funcFile SingleFunctionFile, declared map[string]bool) (string, bool, error) {
+	src := funcFile.Package + funcFile.Imports + funcFile.Func
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return "", false, err
+	}
+	var decl *ast.FuncDecl
+	for _, d := range file.Decls {
+		if d, ok := d.(*ast.FuncDecl); ok {
+			decl = d
+		}
+	}
+	if decl == nil || decl.Recv != nil || decl.Body == nil || !decl.Name.IsExported() || declared[subPackageName] {
+		return "", false, nil
+	}
+	if slices.ContainsFunc(file.Imports, func(spec *ast.ImportSpec) bool { return spec.Path.Value == `"C"` }) {
+		return "", false, nil
+	}
+	refersTo := func(name string) bool { return declared[name] && name != decl.Name.Name || name == subPackageName }
+	if refs := packageRefs(decl.Type, refersTo); len(refs) > 0 {
+		return "", false, nil
+	}
+	if refs := packageRefs(decl.Body, refersTo); len(refs) > 0 {
+		return "", false, nil
+	}
+
+	var typeArgs, args []string
+	if decl.Type.TypeParams != nil {
+		for _, field := range decl.Type.TypeParams.List {
+			for _, name := range field.Names {
+				typeArgs = append(typeArgs, name.Name)
+			}
+		}
+	}
+	n := 0
+	for _, field := range decl.Type.Params.List {
+		if len(field.Names) == 0 {
+			field.Names = []*ast.Ident{ast.NewIdent("")}
+		}
+		for _, name := range field.Names {
+			n++
+			if name.Name == "" || name.Name == "_" {
+				name.Name = fmt.Sprintf("arg%d", n)
+			}
+			arg := name.Name
+			if _, ok := field.Type.(*ast.Ellipsis); ok {
+				arg += "..."
+			}
+			args = append(args, arg)
+		}
+	}
+	call := subPackageName + "." + decl.Name.Name
+	if len(typeArgs) > 0 {
+		call += "[" + strings.Join(typeArgs, ", ") + "]"
+	}
+	call += "(" + strings.Join(args, ", ") + ")"
+	if decl.Type.Results != nil {
+		call = "return " + call
+	}
+
+	// The doc comment is kept as it is and the signature is printed with the parameters named
+	var buf bytes.Buffer
+	start := len(funcFile.Package + funcFile.Imports)
+	buf.WriteString(src[start:fset.Position(decl.Pos()).Offset])
+	if err := printer.Fprint(&buf, fset, &ast.FuncDecl{Name: decl.Name, Type: decl.Type}); err != nil {
+		return "", false, err
+	}
+	fmt.Fprintf(&buf, " {\n\t%s\n}", call)
+	buf.WriteString(src[fset.Position(decl.End()).Offset:])
+	return buf.String(), true, nil
+}
+
+// packageRefs returns the names the node refers to for which refersTo reports true, in order of appearance
+// Selected names, like the field in x.Field, are not references.
+func packageRefs(node ast.Node, refersTo func(string) bool) []string {
+	var refs []string
+	var visit func(ast.Node) bool
+	visit = func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			ast.Inspect(n.X, visit)
+			return false
+		case *ast.Ident:
+			if refersTo(n.Name) && !slices.Contains(refs, n.Name) {
+				refs = append(refs, n.Name)
+			}
+		}
+		return true
+	}
+	ast.Inspect(node, visit)
+	return refs
+}
+
+// subPackageClause returns the package declaration of a file of the sub-package
+// The build constraint of the original file is kept, while its other comments, such as the package doc, are not.
+func subPackageClause(packageDecl string) string {
+	var constraint string
+	if file, err := parser.ParseFile(token.NewFileSet(), "", packageDecl, parser.PackageClauseOnly|parser.ParseComments); err == nil {
+		if expr := buildConstraint(file); expr != "" {
+			constraint = "//go:build " + expr + "\n\n"
+		}
+	}
+	return constraint + "package " + subPackageName + "\n\n"
+}
@@ -0,0 +1,88 @@
+package fsplit
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSubPackage(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.22\n",
+		"p/a.go": `package p
+
+import "strings"
+
+const limit = 3
+
+// Upper upper-cases s
+func Upper(s string) string {
+	return strings.ToUpper(s)
+}
+
+// Join joins the values
+func Join[T any](sep string, vals ...T) string {
+	return strings.Repeat(sep, len(vals))
+}
+
+// Clip refers to limit, so it stays in the package
+func Clip(s string) string {
+	return s[:limit]
+}
+
+func Ignore(int, string) {}
+
+func helper() {}
+`,
+	})
+	result, files := runFsplit(t, dir+"/p", Options{SubPackage: true, Verify: true})
+
+	want := []string{
+		"a._.Clip.fsplit.go",
+		"a._.Ignore.fsplit.go",
+		"a._.Join.fsplit.go",
+		"a._.Upper.fsplit.go",
+		"a._.helper.fsplit.go",
+		"a.go",
+		"fsplit/a._.Ignore.fsplit.go",
+		"fsplit/a._.Join.fsplit.go",
+		"fsplit/a._.Upper.fsplit.go",
+	}
+	if got := fileNames(files); !slices.Equal(got, want) {
+		t.Fatalf("files = %v, want %v", got, want)
+	}
+	if len(result.SubPackage) != 3 {
+		t.Errorf("SubPackage = %v, want the 3 files of the sub-package", result.SubPackage)
+	}
+
+	forwarders := map[string]string{
+		"a._.Upper.fsplit.go":  "// Upper upper-cases s\nfunc Upper(s string) string {\n\treturn fsplit.Upper(s)\n}\n",
+		"a._.Join.fsplit.go":   "// Join joins the values\nfunc Join[T any](sep string, vals ...T) string {\n\treturn fsplit.Join[T](sep, vals...)\n}\n",
+		"a._.Ignore.fsplit.go": "func Ignore(arg1 int, arg2 string) {\n\tfsplit.Ignore(arg1, arg2)\n}\n",
+	}
+	for name, forwarder := range forwarders {
+		src := files[name]
+		if !strings.Contains(src, "package p\n") || !strings.Contains(src, `import "example.com/m/p/fsplit"`) || !strings.HasSuffix(src, forwarder) {
+			t.Errorf("%s is not a forwarder:\n%s", name, src)
+		}
+		sub := files["fsplit/"+name]
+		if !strings.Contains(sub, "package fsplit\n") || strings.Contains(sub, "fsplit.") {
+			t.Errorf("fsplit/%s does not declare the function:\n%s", name, sub)
+		}
+	}
+	if src := files["fsplit/a._.Upper.fsplit.go"]; !strings.Contains(src, "return strings.ToUpper(s)") {
+		t.Errorf("the sub-package lacks the body of Upper:\n%s", src)
+	}
+	if src := files["a._.Clip.fsplit.go"]; !strings.Contains(src, "return s[:limit]") {
+		t.Errorf("Clip was not kept in the package:\n%s", src)
+	}
+}
+
+func TestSubPackageNeedsModule(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"a.go": "package p\n\nfunc A() {}\n\nfunc B() {}\n",
+	})
+	if _, err := RunFsplitWithOptions(dir, Options{SubPackage: true, NoConfigFile: true}); err == nil {
+		t.Error("splitting into a sub-package outside of a module succeeded")
+	}
+}
@@ -0,0 +1,67 @@
+package fsplit
+
+import (
+	"go/ast"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// testFuncKind is the kind of a function with a special meaning to go test
+type testFuncKind string
+
+const (
+	testFuncNone      testFuncKind = ""
+	testFuncMain      testFuncKind = "TestMain"
+	testFuncTest      testFuncKind = "test"
+	testFuncBenchmark testFuncKind = "benchmark"
+	testFuncFuzz      testFuncKind = "fuzz"
+	testFuncExample   testFuncKind = "example"
+)
+
+// testFuncPrefixes maps the name prefixes of test functions to their kinds
+var testFuncPrefixes = []struct {
+	prefix string
+	kind   testFuncKind
+}{
+	{"Test", testFuncTest},
+	{"Benchmark", testFuncBenchmark},
+	{"Fuzz", testFuncFuzz},
+	{"Example", testFuncExample},
+}
+
+// isTestFile checks if the file is a test file by its name
+func isTestFile(fileName string) bool {
+	return strings.HasSuffix(fileName, "_test.go")
+}
+
+// getTestFuncKind gets the kind of the function if it is declared in a test file
+// Functions in other files and methods are never test functions.
+func getTestFuncKind(fileName string, decl *ast.FuncDecl) testFuncKind {
+	if !isTestFile(fileName) || decl.Recv != nil {
+		return testFuncNone
+	}
+	name := decl.Name.Name
+	if name == "TestMain" {
+		return testFuncMain
+	}
+	for _, p := range testFuncPrefixes {
+		if isTestName(name, p.prefix) {
+			return p.kind
+		}
+	}
+	return testFuncNone
+}
+
+// isTestName checks if the name is the prefix followed by nothing or by a character that is not a lower case letter
+// This is the same rule go test uses to recognize test functions.
+func isTestName(name, prefix string) bool {
+	if !strings.HasPrefix(name, prefix) {
+		return false
+	}
+	if len(name) == len(prefix) {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(name[len(prefix):])
+	return !unicode.IsLower(r)
+}
@@ -0,0 +1,50 @@
+package fsplit
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestGetTestFuncKind(t *testing.T) {
+	tests := []struct {
+		fileName string
+		src      string
+		want     testFuncKind
+	}{
+		{"a_test.go", "func TestMain(m *testing.M) {}", testFuncMain},
+		{"a_test.go", "func TestA(t *testing.T) {}", testFuncTest},
+		{"a_test.go", "func Test(t *testing.T) {}", testFuncTest},
+		{"a_test.go", "func Testable() {}", testFuncNone},
+		{"a_test.go", "func BenchmarkA(b *testing.B) {}", testFuncBenchmark},
+		{"a_test.go", "func Benchmark_a(b *testing.B) {}", testFuncBenchmark},
+		{"a_test.go", "func FuzzA(f *testing.F) {}", testFuncFuzz},
+		{"a_test.go", "func Fuzzy() {}", testFuncNone},
+		{"a_test.go", "func ExampleA() {}", testFuncExample},
+		{"a_test.go", "func Example() {}", testFuncExample},
+		{"a_test.go", "func (T) TestA(t *testing.T) {}", testFuncNone},
+		{"a.go", "func TestA(t *testing.T) {}", testFuncNone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fileName+"/"+tt.src, func(t *testing.T) {
+			decl := parseFunc(t, "package a\n\n"+tt.src+"\n")
+			if got := getTestFuncKind(tt.fileName, decl); got != tt.want {
+				t.Errorf("getTestFuncKind() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSkipExamples(t *testing.T) {
+	dir := writePackage(t, map[string]string{
+		"a.go":      "package p\n\nfunc A() {}\n",
+		"a_test.go": "package p\n\nimport \"testing\"\n\nfunc BenchmarkA(b *testing.B) {}\n\nfunc FuzzA(f *testing.F) {}\n\nfunc ExampleA() {}\n",
+	})
+	_, files := runFsplit(t, dir, Options{IncludeTests: true, SkipExamples: true})
+	want := []string{"a._.BenchmarkA.fsplit_test.go", "a._.FuzzA.fsplit_test.go", "a.go", "a_test.go"}
+	if !slices.Equal(fileNames(files), want) {
+		t.Fatalf("files = %v, want %v", fileNames(files), want)
+	}
+	if want := "package p\n\nfunc ExampleA() {}\n"; files["a_test.go"] != want {
+		t.Errorf("a_test.go =\n%s\nwant\n%s", files["a_test.go"], want)
+	}
+}
@@ -0,0 +1,160 @@
+package fsplit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+)
+
+// snapshot holds the contents of the Go files of a package before they are modified
+type snapshot map[string]snapshotFile
+
+// snapshotFile is the content and permissions of a file in a snapshot
+type snapshotFile struct {
+	content []byte
+	perm    os.FileMode
+}
+
+// takeSnapshot reads the contents of every Go file in the directory
+func takeSnapshot(fsys FileSystem, dir string) (snapshot, error) {
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	snap := make(snapshot)
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".go" {
+			continue
+		}
+		name := filepath.Join(dir, entry.Name())
+		content, err := fsys.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		snap[name] = snapshotFile{content: content, perm: fileMode(fsys, name)}
+	}
+	return snap, nil
+}
+
+// restore restores the written files to the snapshot
+// Files that did not exist when the snapshot was taken are removed, and files that still match it are not written.
+func (snap snapshot) restore(fsys FileSystem, written []string) error {
+	var errs []error
+	for _, name := range written {
+		name = filepath.Clean(name)
+		if file, ok := snap[name]; ok {
+			_, err := writeFileIfChanged(fsys, name, file.content, file.perm)
+			errs = append(errs, err)
+		} else if err := fsys.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// goTest runs the tests of the package in dir with the go command
+// It is a variable so that tests can stub the go command out.
+var goTest = func(ctx context.Context, dir string) error {
+	cmd := exec.CommandContext(ctx, "go", "test", ".")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("go test: %v\n%s", err, out)
+	}
+	return nil
+}
+
+// verifyFiles checks that every file still parses
+// It reports every file that does not parse along with the error.
+func verifyFiles(fsys FileSystem, files []string) error {
+	fset := token.NewFileSet()
+	var errs []error
+	for _, name := range files {
+		src, err := fsys.ReadFile(name)
+		if err == nil {
+			_, err = parser.ParseFile(fset, name, src, parser.ParseComments)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// symbolCounts counts how many times each top-level symbol is declared in the package directory
+// Symbols are keyed by package name, and methods are qualified with their receiver type name.
+// The index written by Options.Index is not counted, since a run may add it or already find it.
+func symbolCounts(fsys FileSystem, packagePath string) (map[string]int, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parseDir(fset, fsys, packagePath, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for pkgName, pkg := range pkgs {
+		add := func(name string) {
+			if name != "_" {
+				counts[pkgName+"."+name]++
+			}
+		}
+		for fileName, file := range pkg.Files {
+			if filepath.Base(fileName) == indexFileName {
+				continue
+			}
+			for _, decl := range file.Decls {
+				switch decl := decl.(type) {
+				case *ast.FuncDecl:
+					add(qualifiedFuncName(decl))
+				case *ast.GenDecl:
+					for _, spec := range decl.Specs {
+						switch spec := spec.(type) {
+						case *ast.TypeSpec:
+							add(spec.Name.Name)
+						case *ast.ValueSpec:
+							for _, name := range spec.Names {
+								add(name.Name)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return counts, nil
+}
+
+// compareSymbols reports every symbol whose number of declarations changed
+func compareSymbols(before, after map[string]int) error {
+	var names []string
+	for name := range before {
+		names = append(names, name)
+	}
+	for name := range after {
+		if _, ok := before[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	var errs []error
+	for _, name := range names {
+		switch b, a := before[name], after[name]; {
+		case a == b:
+		case a == 0:
+			errs = append(errs, fmt.Errorf("%s: missing after split", name))
+		case b == 0:
+			errs = append(errs, fmt.Errorf("%s: added by split", name))
+		default:
+			errs = append(errs, fmt.Errorf("%s: declared %d times before split, %d times after", name, b, a))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,80 @@
+package fsplit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"maps"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// droppingFileSystem drops a line from a file once it was read the given number of times,
+// like a broken rewrite losing a declaration
+type droppingFileSystem struct {
+	FileSystem
+	name  string
+	line  string
+	reads int
+}
+
+func (fsys *droppingFileSystem) ReadFile(name string) ([]byte, error) {
+	data, err := fsys.FileSystem.ReadFile(name)
+	if err != nil || name != fsys.name {
+		return data, err
+	}
+	if fsys.reads--; fsys.reads < 0 {
+		data = bytes.Replace(data, []byte(fsys.line), nil, 1)
+	}
+	return data, nil
+}
+
+func TestRunTestsRollback(t *testing.T) {
+	files := map[string]string{
+		"a.go": "package p\n\n// A is kept\nfunc A() {}\n\nfunc B() {}\n",
+		"b.go": "package p\n\nfunc C() {}\n\nfunc D() {}\n",
+	}
+	dir := writePackage(t, files)
+	goTestOrig := goTest
+	t.Cleanup(func() { goTest = goTestOrig })
+	var tested string
+	goTest = func(ctx context.Context, dir string) error {
+		tested = dir
+		return errors.New("FAIL")
+	}
+
+	_, err := RunFsplitWithOptions(dir, Options{RunTests: true, NoConfigFile: true})
+	if err == nil || !strings.Contains(err.Error(), "rolled back") {
+		t.Fatalf("err = %v, want the failed tests rolled back", err)
+	}
+	if tested != dir {
+		t.Errorf("tested %q, want %q", tested, dir)
+	}
+	got := readPackage(t, dir)
+	for name := range got {
+		if strings.HasSuffix(name, ".fsplit.go") {
+			t.Errorf("%s was not removed", name)
+		}
+	}
+	if !maps.Equal(got, files) {
+		t.Errorf("files after the rollback = %v, want %v", got, files)
+	}
+}
+
+func TestVerifyDroppedSymbol(t *testing.T) {
+	files := map[string]string{
+		"a.go": "package p\n\nvar dropped = 1\n\nfunc A() {}\n\nfunc B() {}\n",
+	}
+	dir := writePackage(t, files)
+	// The symbols are counted from the first read, and the split reads the file without dropped
+	fsys := &droppingFileSystem{FileSystem: osFileSystem{}, name: filepath.Join(dir, "a.go"), line: "var dropped = 1\n", reads: 1}
+
+	_, err := RunFsplitWithOptions(dir, Options{Verify: true, FileSystem: fsys, NoConfigFile: true})
+	if err == nil || !strings.Contains(err.Error(), "p.dropped: missing after split") {
+		t.Fatalf("err = %v, want p.dropped reported missing", err)
+	}
+	if got := readPackage(t, dir); !maps.Equal(got, files) {
+		t.Errorf("files after the failed verification = %v, want %v", got, files)
+	}
+}
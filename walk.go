@@ -0,0 +1,99 @@
+package fsplit
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RunFsplitRecursive runs the fsplit tool with the given options on every package under the root directory
+// It returns the results of all packages merged into one.
+func RunFsplitRecursive(root string, opts Options) (*Result, error) {
+	return RunFsplitRecursiveContext(context.Background(), root, opts)
+}
+
+// RunFsplitRecursiveContext runs the fsplit tool with the given options on every package under the root directory
+// Packages are split one after another, and ctx is checked between them.
+// If a package fails, the packages split before it stay split.
+// After Options.Deadline, no new package is started and the remaining ones are recorded as skipped.
+func RunFsplitRecursiveContext(ctx context.Context, root string, opts Options) (*Result, error) {
+	dirs, err := packageDirs(opts.fileSystem(), root, opts)
+	if err != nil {
+		return nil, fmt.Errorf("Error walking %s: %v", root, err)
+	}
+	return splitPackages(ctx, dirs, opts)
+}
+
+// splitPackages splits the packages in the directories one after another as described for RunFsplitRecursiveContext
+func splitPackages(ctx context.Context, dirs []string, opts Options) (*Result, error) {
+	start := time.Now()
+	result := &Result{}
+	for i, dir := range dirs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if opts.Deadline > 0 && time.Since(start) > opts.Deadline {
+			opts.logf("deadline passed, skipping %d packages", len(dirs)-i)
+			result.Skipped = dirs[i:]
+			break
+		}
+		opts.logf("package %s", dir)
+		r, err := RunFsplitWithOptionsContext(ctx, dir, opts)
+		if err != nil {
+			return nil, fmt.Errorf("Error splitting %s: %w", dir, err)
+		}
+		result.Merge(r)
+	}
+	return result, nil
+}
+
+// packageDirs returns the directories under root, including root, that contain Go files, in lexical order
+// Like the go command, it skips vendor and testdata directories and directories starting with "." or "_".
+// Directories ignored by .gitignore files under root are skipped as well.
+// Options.NoIgnore disables both.
+func packageDirs(fsys FileSystem, root string, opts Options) ([]string, error) {
+	var dirs []string
+	var walk func(dir string, rules ignoreRules) error
+	walk = func(dir string, rules ignoreRules) error {
+		if !opts.NoIgnore {
+			var err error
+			if rules, err = readIgnoreRules(fsys, dir, rules); err != nil {
+				return err
+			}
+		}
+		entries, err := fsys.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		hasGoFiles := false
+		var subdirs []string
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			if !opts.NoIgnore && (isSkippedDir(entry.Name(), entry.IsDir()) || rules.isIgnored(path, entry.IsDir())) {
+				continue
+			}
+			if entry.IsDir() {
+				subdirs = append(subdirs, path)
+			} else if filepath.Ext(entry.Name()) == ".go" {
+				hasGoFiles = true
+			}
+		}
+		if hasGoFiles {
+			dirs = append(dirs, dir)
+		}
+		for _, subdir := range subdirs {
+			if err := walk(subdir, rules); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return dirs, walk(filepath.Clean(root), nil)
+}
+
+// isSkippedDir checks if the entry is a directory the go command ignores
+func isSkippedDir(name string, isDir bool) bool {
+	return isDir && (name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_"))
+}
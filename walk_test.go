@@ -0,0 +1,61 @@
+package fsplit
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// writePackages writes two packages a and b of two functions each under a new temporary directory and returns it
+// goTest is stubbed with the function for the rest of the test.
+func writePackages(t *testing.T, test func(ctx context.Context, dir string) error) string {
+	t.Helper()
+	root := writePackage(t, map[string]string{
+		"a/a.go": "package a\n\nfunc A() {}\n\nfunc B() {}\n",
+		"b/b.go": "package b\n\nfunc C() {}\n\nfunc D() {}\n",
+	})
+	goTestOrig := goTest
+	t.Cleanup(func() { goTest = goTestOrig })
+	goTest = test
+	return root
+}
+
+func TestRecursiveDeadline(t *testing.T) {
+	// Testing a is slow, so b is not started before the deadline
+	root := writePackages(t, func(ctx context.Context, dir string) error {
+		time.Sleep(100 * time.Millisecond)
+		return nil
+	})
+	result, err := RunFsplitRecursive(root, Options{Deadline: 50 * time.Millisecond, RunTests: true, NoConfigFile: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{filepath.Join(root, "b")}; !slices.Equal(result.Skipped, want) {
+		t.Errorf("Skipped = %v, want %v", result.Skipped, want)
+	}
+	files := readPackage(t, root)
+	if want := []string{"a/a._.A.fsplit.go", "a/a._.B.fsplit.go", "a/a.go", "b/b.go"}; !slices.Equal(fileNames(files), want) {
+		t.Errorf("files = %v, want a split and b untouched in %v", fileNames(files), want)
+	}
+}
+
+func TestRecursiveCanceled(t *testing.T) {
+	// The context expires while a is tested, so b is not started
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	root := writePackages(t, func(context.Context, string) error {
+		cancel()
+		return nil
+	})
+	_, err := RunFsplitRecursiveContext(ctx, root, Options{RunTests: true, NoConfigFile: true})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want %v", err, context.Canceled)
+	}
+	files := readPackage(t, root)
+	if want := []string{"a/a._.A.fsplit.go", "a/a._.B.fsplit.go", "a/a.go", "b/b.go"}; !slices.Equal(fileNames(files), want) {
+		t.Errorf("files = %v, want a split and b untouched in %v", fileNames(files), want)
+	}
+}